@@ -0,0 +1,326 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Name  string
+	Roles []string
+}
+
+type (
+	principalKey struct{}
+	authErrorKey struct{}
+)
+
+// PrincipalFromContext returns the principal the server's Authenticator yielded for the request
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// Authenticator verifies the credentials of a caller and yields its principal.
+// The server runs it once in the handshake with Option.Metadata, serviceMethod is empty then,
+// and for every request of a connection that the handshake did not authenticate, with the request metadata.
+type Authenticator interface {
+	Authenticate(ctx context.Context, serviceMethod string, md Metadata) (*Principal, error)
+}
+
+// AuthenticatorFunc adapts a function to the Authenticator interface
+type AuthenticatorFunc func(ctx context.Context, serviceMethod string, md Metadata) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, serviceMethod string, md Metadata) (*Principal, error) {
+	return f(ctx, serviceMethod, md)
+}
+
+// Rule lists who may call a method: any principal named in Principals, or holding one of Roles.
+// The name "*" allows every authenticated principal.
+type Rule struct {
+	Principals []string
+	Roles      []string
+}
+
+func (r Rule) allows(p *Principal) bool {
+	for _, name := range r.Principals {
+		if name == "*" || name == p.Name {
+			return true
+		}
+	}
+	for _, role := range r.Roles {
+		for _, has := range p.Roles {
+			if role == has {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Policy maps "Service.Method", or "Service" for all its methods, to the rule of who may call it.
+// Methods without a rule are open to everyone, including unauthenticated callers and callers whose credentials
+// are rejected.
+type Policy map[string]Rule
+
+func (p Policy) rule(serviceMethod string) (Rule, bool) {
+	if r, ok := p[serviceMethod]; ok {
+		return r, true
+	}
+	if dot := strings.LastIndex(serviceMethod, "."); dot >= 0 {
+		r, ok := p[serviceMethod[:dot]]
+		return r, ok
+	}
+	return Rule{}, false
+}
+
+// WithAuthenticator makes the server authenticate callers with a
+func WithAuthenticator(a Authenticator) ServerOption {
+	return func(s *Server) {
+		s.authenticator = a
+	}
+}
+
+// WithPolicy makes the server authorize every request against p
+func WithPolicy(p Policy) ServerOption {
+	return func(s *Server) {
+		s.policy = p
+	}
+}
+
+// unauthenticated makes sure an error returned by an Authenticator carries an auth code
+func unauthenticated(err error) error {
+	if c := CodeOf(err); c == CodeUnauthenticated || c == CodePermissionDenied {
+		return err
+	}
+	return Errorf(CodeUnauthenticated, "rpc server: unauthenticated: %s", err)
+}
+
+// authenticateConn runs the authenticator with the handshake metadata, the result is stored in ctx
+func (s *Server) authenticateConn(ctx context.Context, opt *Option) context.Context {
+	if s.authenticator == nil || len(opt.Metadata) == 0 {
+		return ctx
+	}
+	p, err := s.authenticator.Authenticate(ctx, "", opt.Metadata)
+	if err != nil {
+		return context.WithValue(ctx, authErrorKey{}, unauthenticated(err))
+	}
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// authorize authenticates req if its connection is not authenticated yet, then checks it against the policy.
+// Methods without a rule ignore authentication failures, the call is then anonymous.
+func (s *Server) authorize(req *request) error {
+	if s.authenticator == nil && s.policy == nil {
+		return nil
+	}
+	authErr, _ := req.ctx.Value(authErrorKey{}).(error)
+	p, ok := PrincipalFromContext(req.ctx)
+	if !ok && authErr == nil && s.authenticator != nil && len(req.md) > 0 {
+		var err error
+		if p, err = s.authenticator.Authenticate(req.ctx, req.h.ServiceMethod, req.md); err != nil {
+			authErr = unauthenticated(err)
+		} else {
+			ok = p != nil
+			req.ctx = context.WithValue(req.ctx, principalKey{}, p)
+		}
+	}
+	rule, found := s.policy.rule(req.h.ServiceMethod)
+	switch {
+	case !found:
+		return nil
+	case authErr != nil:
+		return authErr
+	case !ok:
+		return Errorf(CodeUnauthenticated, "rpc server: unauthenticated call to %s", req.h.ServiceMethod)
+	case !rule.allows(p):
+		return Errorf(CodePermissionDenied, "rpc server: %s is not allowed to call %s", p.Name, req.h.ServiceMethod)
+	}
+	return nil
+}
+
+// Credentials supply the metadata that authenticates a call, see Option.Credentials
+type Credentials interface {
+	Metadata(serviceMethod string) (Metadata, error)
+}
+
+// withCredentials returns md merged with the metadata of creds, md itself is not modified
+func withCredentials(creds Credentials, serviceMethod string, md Metadata) (Metadata, error) {
+	cmd, err := creds.Metadata(serviceMethod)
+	if err != nil {
+		return nil, err
+	}
+	merged := make(Metadata, len(md)+len(cmd))
+	for k, v := range md {
+		merged[k] = v
+	}
+	for k, v := range cmd {
+		merged[k] = v
+	}
+	return merged, nil
+}
+
+const authorizationKey = "authorization"
+
+type bearerToken string
+
+// BearerToken sends token in the "authorization" metadata of every call
+func BearerToken(token string) Credentials {
+	return bearerToken(token)
+}
+
+func (t bearerToken) Metadata(string) (Metadata, error) {
+	return Metadata{authorizationKey: "Bearer " + string(t)}, nil
+}
+
+type bearerAuthenticator map[string]*Principal
+
+// NewBearerAuthenticator authenticates callers by the token sent with BearerToken, tokens maps a token to its principal
+func NewBearerAuthenticator(tokens map[string]*Principal) Authenticator {
+	return bearerAuthenticator(tokens)
+}
+
+func (a bearerAuthenticator) Authenticate(_ context.Context, _ string, md Metadata) (*Principal, error) {
+	token, ok := strings.CutPrefix(md[authorizationKey], "Bearer ")
+	if !ok {
+		return nil, Errorf(CodeUnauthenticated, "rpc server: missing bearer token")
+	}
+	var found *Principal
+	for t, p := range a { // compare every token in constant time, don't leak which prefix matched
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			found = p
+		}
+	}
+	if found == nil {
+		return nil, Errorf(CodeUnauthenticated, "rpc server: invalid bearer token")
+	}
+	return found, nil
+}
+
+const (
+	hmacKeyIDKey     = "x-geerpc-key-id"
+	hmacTimestampKey = "x-geerpc-timestamp"
+	hmacNonceKey     = "x-geerpc-nonce"
+	hmacSignatureKey = "x-geerpc-signature"
+)
+
+func hmacSign(secret []byte, serviceMethod, timestamp, nonce string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(serviceMethod + "\n" + timestamp + "\n" + nonce))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type hmacCredentials struct {
+	keyID  string
+	secret []byte
+}
+
+// HMACCredentials authenticates every call with secret: the signature is an HMAC-SHA256 of the
+// service method, the current unix time and a random nonce, sent along with keyID in the call metadata.
+// NewHMACAuthenticator accepts a nonce only once, so a captured signature can't be replayed.
+// The args aren't signed, combine it with TLS to protect them.
+func HMACCredentials(keyID string, secret []byte) Credentials {
+	return &hmacCredentials{keyID: keyID, secret: secret}
+}
+
+func (c *hmacCredentials) Metadata(serviceMethod string) (Metadata, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	ts, nonce := strconv.FormatInt(time.Now().Unix(), 10), hex.EncodeToString(b)
+	return Metadata{
+		hmacKeyIDKey:     c.keyID,
+		hmacTimestampKey: ts,
+		hmacNonceKey:     nonce,
+		hmacSignatureKey: hmacSign(c.secret, serviceMethod, ts, nonce),
+	}, nil
+}
+
+// HMACKey is the shared secret of a caller and the principal it authenticates as
+type HMACKey struct {
+	Secret    []byte
+	Principal *Principal
+}
+
+type hmacAuthenticator struct {
+	keys    map[string]HMACKey
+	maxSkew time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time // key id and nonce of the accepted signatures, to when they expire
+	lastSweep time.Time
+}
+
+const defaultHMACSkew = time.Minute * 5
+
+// NewHMACAuthenticator verifies calls signed with HMACCredentials, keys maps a key id to its secret.
+// Signatures older or newer than maxSkew are rejected, 0 means 5 minutes.
+// The nonces seen within that window are remembered, a signature whose nonce was seen is rejected.
+func NewHMACAuthenticator(keys map[string]HMACKey, maxSkew time.Duration) Authenticator {
+	if maxSkew == 0 {
+		maxSkew = defaultHMACSkew
+	}
+	return &hmacAuthenticator{keys: keys, maxSkew: maxSkew, seen: make(map[string]time.Time), lastSweep: time.Now()}
+}
+
+func (a *hmacAuthenticator) Authenticate(_ context.Context, serviceMethod string, md Metadata) (*Principal, error) {
+	keyID := md[hmacKeyIDKey]
+	key, ok := a.keys[keyID]
+	if !ok {
+		return nil, Errorf(CodeUnauthenticated, "rpc server: unknown hmac key id %q", keyID)
+	}
+	ts, nonce := md[hmacTimestampKey], md[hmacNonceKey]
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, Errorf(CodeUnauthenticated, "rpc server: invalid hmac timestamp %q", ts)
+	}
+	signed := time.Unix(sec, 0)
+	if skew := time.Since(signed); skew > a.maxSkew || skew < -a.maxSkew {
+		return nil, Errorf(CodeUnauthenticated, "rpc server: hmac signature expired")
+	}
+	if nonce == "" {
+		return nil, Errorf(CodeUnauthenticated, "rpc server: missing hmac nonce")
+	}
+	expected := hmacSign(key.Secret, serviceMethod, ts, nonce)
+	if !hmac.Equal([]byte(expected), []byte(md[hmacSignatureKey])) {
+		return nil, Errorf(CodeUnauthenticated, "rpc server: invalid hmac signature")
+	}
+	if !a.firstUse(keyID+"\n"+nonce, signed.Add(a.maxSkew)) {
+		return nil, Errorf(CodeUnauthenticated, "rpc server: replayed hmac signature")
+	}
+	if key.Principal != nil {
+		return key.Principal, nil
+	}
+	return &Principal{Name: keyID}, nil
+}
+
+// firstUse records nonce until expire, it reports whether nonce was not recorded yet.
+// Once expired a signature fails the skew check, so its nonce is forgotten.
+func (a *hmacAuthenticator) firstUse(nonce string, expire time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	if now.Sub(a.lastSweep) > a.maxSkew {
+		for n, e := range a.seen {
+			if now.After(e) {
+				delete(a.seen, n)
+			}
+		}
+		a.lastSweep = now
+	}
+	if _, ok := a.seen[nonce]; ok {
+		return false
+	}
+	a.seen[nonce] = expire
+	return true
+}
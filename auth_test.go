@@ -0,0 +1,113 @@
+package geerpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type Report int
+
+func (r Report) Whoami(ctx context.Context, _ int, reply *string) error {
+	if p, ok := PrincipalFromContext(ctx); ok {
+		*reply = p.Name
+	}
+	return nil
+}
+
+func (r Report) Generate(_ int, reply *string) error {
+	*reply = "report"
+	return nil
+}
+
+func (r Report) Status(_ int, reply *string) error {
+	*reply = "ok"
+	return nil
+}
+
+func startAuthServer(t *testing.T, a Authenticator) string {
+	s := NewServer(WithAuthenticator(a), WithPolicy(Policy{
+		"Report.Generate": {Roles: []string{"admin"}},
+		"Report.Whoami":   {Principals: []string{"*"}},
+	}))
+	return startTestServer(t, s, new(Report))
+}
+
+func TestServer_BearerAuth(t *testing.T) {
+	addr := startAuthServer(t, NewBearerAuthenticator(map[string]*Principal{
+		"alice-token": {Name: "alice", Roles: []string{"admin"}},
+		"bob-token":   {Name: "bob"},
+	}))
+	call := func(opt *Option, method string) (string, error) {
+		opt.MagicNumber = MagicNumber
+		client, err := Dial("tcp", addr, opt)
+		_assert(err == nil, "dial error: %v", err)
+		defer func() { _ = client.Close() }()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second) // sends x-geerpc-timeout metadata
+		defer cancel()
+		var reply string
+		err = client.Call(ctx, method, 0, &reply)
+		return reply, err
+	}
+
+	reply, err := call(&Option{Credentials: BearerToken("alice-token")}, "Report.Generate")
+	_assert(err == nil && reply == "report", "expect alice to generate a report, got %q %v", reply, err)
+	reply, err = call(&Option{Metadata: Metadata{"authorization": "Bearer bob-token"}}, "Report.Whoami")
+	_assert(err == nil && reply == "bob", "expect handshake to authenticate bob, got %q %v", reply, err)
+	_, err = call(&Option{Credentials: BearerToken("bob-token")}, "Report.Generate")
+	_assert(CodeOf(err) == CodePermissionDenied, "expect PermissionDenied, got %v", err)
+	_, err = call(&Option{}, "Report.Whoami")
+	_assert(CodeOf(err) == CodeUnauthenticated, "expect Unauthenticated without credentials, got %v", err)
+	_, err = call(&Option{Credentials: BearerToken("mallory")}, "Report.Whoami")
+	_assert(CodeOf(err) == CodeUnauthenticated, "expect Unauthenticated for unknown token, got %v", err)
+	_, err = call(&Option{Metadata: Metadata{"authorization": "Bearer mallory"}}, "Report.Whoami")
+	_assert(CodeOf(err) == CodeUnauthenticated, "expect failed handshake to reject calls, got %v", err)
+	reply, err = call(&Option{}, "Report.Status")
+	_assert(err == nil && reply == "ok", "expect methods without a rule to stay open, got %q %v", reply, err)
+	reply, err = call(&Option{Credentials: BearerToken("mallory")}, "Report.Status")
+	_assert(err == nil && reply == "ok", "expect rejected credentials not to close open methods, got %q %v", reply, err)
+}
+
+func TestServer_HMACAuth(t *testing.T) {
+	secret := []byte("s3cret")
+	a := NewHMACAuthenticator(map[string]HMACKey{
+		"svc-a": {Secret: secret, Principal: &Principal{Name: "svc-a", Roles: []string{"admin"}}},
+	}, time.Minute)
+	addr := startAuthServer(t, a)
+
+	client, err := Dial("tcp", addr, &Option{MagicNumber: MagicNumber, Credentials: HMACCredentials("svc-a", secret)})
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	var reply string
+	err = client.Call(context.Background(), "Report.Generate", 0, &reply)
+	_assert(err == nil && reply == "report", "expect signed call to succeed, got %q %v", reply, err)
+
+	// a captured signature is accepted once, whether it is replayed in a request or in a handshake
+	md, _ := HMACCredentials("svc-a", secret).Metadata("Report.Generate")
+	anonymous, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = anonymous.Close() }()
+	err = anonymous.Call(WithMetadata(context.Background(), md), "Report.Generate", 0, &reply)
+	_assert(err == nil && reply == "report", "expect the signed request to succeed, got %q %v", reply, err)
+	err = anonymous.Call(WithMetadata(context.Background(), md), "Report.Generate", 0, &reply)
+	_assert(CodeOf(err) == CodeUnauthenticated, "expect a replayed request to be rejected, got %v", err)
+	md, _ = HMACCredentials("svc-a", secret).Metadata("")
+	for i, want := range []Code{CodeOK, CodeUnauthenticated} {
+		conn, err := Dial("tcp", addr, &Option{MagicNumber: MagicNumber, Metadata: md})
+		_assert(err == nil, "dial error: %v", err)
+		err = conn.Call(context.Background(), "Report.Whoami", 0, &reply)
+		_ = conn.Close()
+		_assert(CodeOf(err) == want, "expect handshake %d to get %s, got %v", i, want, err)
+	}
+
+	md, _ = HMACCredentials("svc-a", secret).Metadata("Report.Whoami")
+	_, err = a.Authenticate(context.Background(), "Report.Generate", md)
+	_assert(CodeOf(err) == CodeUnauthenticated, "expect signature of another method to be rejected")
+	md, _ = HMACCredentials("svc-a", []byte("wrong")).Metadata("Report.Generate")
+	_, err = a.Authenticate(context.Background(), "Report.Generate", md)
+	_assert(CodeOf(err) == CodeUnauthenticated, "expect signature with wrong secret to be rejected")
+	md, _ = HMACCredentials("svc-a", secret).Metadata("Report.Generate")
+	md[hmacTimestampKey] = "1"
+	_, err = a.Authenticate(context.Background(), "Report.Generate", md)
+	_assert(CodeOf(err) == CodeUnauthenticated, "expect stale signature to be rejected")
+}
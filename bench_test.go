@@ -0,0 +1,43 @@
+package geerpc
+
+import (
+	"context"
+	"fmt"
+	"geerpc/codec"
+	"testing"
+)
+
+type Bench int
+
+func (b Bench) Echo(payload []byte, reply *[]byte) error {
+	*reply = payload
+	return nil
+}
+
+func BenchmarkClient_Call(b *testing.B) {
+	addr := startTestServer(b, NewServer(), new(Bench))
+	for _, codecType := range []codec.Type{codec.GobType, codec.JsonType} {
+		for _, size := range []int{16, 1024, 64 * 1024} {
+			b.Run(fmt.Sprintf("%s/%d", codecType, size), func(b *testing.B) {
+				client, err := Dial("tcp", addr, &Option{MagicNumber: MagicNumber, CodecType: codecType})
+				if err != nil {
+					b.Fatal("dial error:", err)
+				}
+				defer func() { _ = client.Close() }()
+				payload := make([]byte, size)
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						var reply []byte
+						if err := client.Call(context.Background(), "Bench.Echo", payload, &reply); err != nil {
+							b.Error("call error:", err)
+							return
+						}
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package geerpc
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// TypeChecker checks local args and reply types against the reflection data of the server and caches the results,
+// CallT uses the one of the Client. Missing methods aren't cached, the service is described again the next time.
+// The zero value is ready to use.
+type TypeChecker struct {
+	services sync.Map // service name -> *ServiceDescriptor
+	checks   sync.Map // typeCheck -> error, nil if the types match
+}
+
+type typeCheck struct {
+	serviceMethod string
+	args, reply   reflect.Type
+}
+
+// Check returns an error if args and reply don't match serviceMethod, the services are described through c
+func (tc *TypeChecker) Check(ctx context.Context, c Caller, serviceMethod string, args, reply reflect.Type) error {
+	key := typeCheck{serviceMethod: serviceMethod, args: args, reply: reply}
+	if err, ok := tc.checks.Load(key); ok {
+		if err == nil {
+			return nil
+		}
+		return err.(error)
+	}
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return Errorf(CodeInvalidArgument, "rpc client: service/method request ill-formed: %s", serviceMethod)
+	}
+	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
+	desci, ok := tc.services.Load(serviceName)
+	if !ok {
+		desc := new(ServiceDescriptor)
+		if err := c.Call(ctx, ReflectionService+".DescribeService", serviceName, desc); err != nil {
+			return err // not cached, the server may be unavailable for now
+		}
+		desci, _ = tc.services.LoadOrStore(serviceName, desc)
+	}
+	m := desci.(*ServiceDescriptor).Method(methodName)
+	if m == nil {
+		// not cached, the method may be registered later, or be on another server behind an XClient
+		tc.services.CompareAndDelete(serviceName, desci)
+		return Errorf(CodeNotFound, "rpc server: can't find method %s", methodName)
+	}
+	err := m.CheckTypes(args, reply)
+	tc.checks.Store(key, err)
+	return err
+}
+
+// TypeOf returns the reflect.Type of T, e.g. for TypeChecker.Check
+func TypeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// TypedCaller is a Caller caching the type checks of CallT, it is implemented by *Client and *xclient.XClient
+type TypedCaller interface {
+	Caller
+	TypeChecker() *TypeChecker
+}
+
+var _ TypedCaller = (*Client)(nil)
+
+// TypeChecker returns the cache of the type checks of CallT
+func (client *Client) TypeChecker() *TypeChecker {
+	return &client.types
+}
+
+// CallT calls serviceMethod with args and returns the reply, which it allocates. The first call of serviceMethod
+// with A and R checks them against the reflection data of the server, the result is cached by c.
+// With an XClient, the servers are expected to run the same services.
+func CallT[A, R any](ctx context.Context, c TypedCaller, serviceMethod string, args A) (R, error) {
+	var reply R
+	if err := c.TypeChecker().Check(ctx, c, serviceMethod, TypeOf[A](), TypeOf[R]()); err != nil {
+		return reply, err
+	}
+	err := c.Call(ctx, serviceMethod, args, &reply)
+	return reply, err
+}
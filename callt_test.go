@@ -0,0 +1,65 @@
+package geerpc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCallT(t *testing.T) {
+	s := NewServer()
+	addr := startTestServer(t, s, new(Foo))
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	ctx := context.Background()
+
+	sum, err := CallT[Args, int](ctx, client, "Foo.Sum", Args{Num1: 1, Num2: 2})
+	_assert(err == nil && sum == 3, "expect 3, got %d, %v", sum, err)
+	sum64, err := CallT[*Args, int64](ctx, client, "Foo.Sum", &Args{Num1: 2, Num2: 2})
+	_assert(err == nil && sum64 == 4, "expect pointers and other sizes of ints to match, got %d, %v", sum64, err)
+
+	type MyArgs struct {
+		Num1 int
+		Num3 int
+	}
+	_, err = CallT[MyArgs, int](ctx, client, "Foo.Sum", MyArgs{})
+	_assert(CodeOf(err) == CodeInvalidArgument, "expect an unknown field to be rejected, got %v", err)
+	_, err = CallT[Args, string](ctx, client, "Foo.Sum", Args{})
+	_assert(CodeOf(err) == CodeInvalidArgument, "expect a reply of another kind to be rejected, got %v", err)
+	_, err = CallT[Args, int](ctx, client, "Foo.Missing", Args{})
+	_assert(CodeOf(err) == CodeNotFound, "expect NotFound, got %v", err)
+
+	svci, _ := s.serviceMap.Load(ReflectionService)
+	describe := svci.(*service).method["DescribeService"]
+	_, _ = CallT[Args, int](ctx, client, "Foo.Sum", Args{})
+	_, _ = CallT[MyArgs, int](ctx, client, "Foo.Sum", MyArgs{})
+	_assert(describe.NumCalls() == 1, "expect the service to be described once, got %d", describe.NumCalls())
+}
+
+// FooV2 is a newer version of the Foo service
+type FooV2 struct{ Foo }
+
+func (f FooV2) Double(n int, reply *int) error {
+	*reply = n * 2
+	return nil
+}
+
+func TestTypeChecker_NotFoundNotCached(t *testing.T) {
+	dial := func(rcvr interface{}) *Client {
+		s := NewServer()
+		_ = s.Register(rcvr, WithServiceName("Foo"))
+		client, err := Dial("tcp", startTestServer(t, s))
+		_assert(err == nil, "dial error: %v", err)
+		return client
+	}
+	var foo Foo
+	v1, v2 := dial(&foo), dial(&FooV2{})
+	defer func() { _, _ = v1.Close(), v2.Close() }()
+
+	var tc TypeChecker
+	ctx := context.Background()
+	err := tc.Check(ctx, v1, "Foo.Double", TypeOf[int](), TypeOf[int]())
+	_assert(CodeOf(err) == CodeNotFound, "expect NotFound on the old server, got %v", err)
+	err = tc.Check(ctx, v2, "Foo.Double", TypeOf[int](), TypeOf[int]())
+	_assert(err == nil, "expect the method of the new server to be found, got %v", err)
+}
@@ -3,15 +3,18 @@ package geerpc
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"geerpc/codec"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,6 +24,7 @@ type Call struct {
 	Args          interface{}
 	Reply         interface{}
 	Error         error
+	Metadata      Metadata   // sent along with the request
 	Done          chan *Call // for rpc client; when call is done, it will be used to notify the application
 }
 
@@ -38,35 +42,58 @@ type Client struct {
 	pending  map[uint64]*Call // save the call that is waiting for response
 	closing  bool             // user has called Close
 	shutdown bool             // server has told us to stop
+	logger   *slog.Logger
+	addr     string // remote address
+	types    TypeChecker
+	done     chan struct{} // closed once the connection is lost or closed and the calls are terminated
 }
 
 var _ io.Closer = (*Client)(nil) // Client must implement io.Closer interface
 
-func newClientByCodec(cc codec.Codec, opt *Option) *Client {
+// Caller makes calls, it is implemented by *Client and *xclient.XClient, and wrapped by generated typed clients
+type Caller interface {
+	Call(ctx context.Context, serviceMethod string, args, reply interface{}) error
+}
+
+var _ Caller = (*Client)(nil)
+
+func newClientByCodec(cc codec.Codec, opt *Option, logger *slog.Logger) *Client {
 	client := &Client{
 		seq:     1, // seq starts from 1, 0 means invalid call
 		cc:      cc,
 		opt:     opt,
 		pending: make(map[uint64]*Call),
+		logger:  logger,
+		done:    make(chan struct{}),
 	}
 	go client.receive() // receive response
 	return client
 }
 
+func loggerOf(opt *Option) *slog.Logger {
+	if opt.Logger == nil {
+		return DiscardLogger
+	}
+	return opt.Logger
+}
+
 func NewClient(conn net.Conn, opt *Option) (*Client, error) {
+	logger := loggerOf(opt).With("remote", conn.RemoteAddr().String())
 	f := codec.NewCodecFuncMap[opt.CodecType]
 	if f == nil {
 		err := fmt.Errorf("invalid codec type %s", opt.CodecType)
-		log.Println("rpc client: options error:", err)
+		logger.Error("rpc client: options error", "err", err)
 		return nil, err
 	}
 
 	if err := json.NewEncoder(conn).Encode(opt); err != nil { // send option to server
-		log.Println("rpc client: options error:", err)
+		logger.Error("rpc client: options error", "err", err)
 		_ = conn.Close()
 		return nil, err
 	}
-	return newClientByCodec(f(conn), opt), nil
+	client := newClientByCodec(f(conn), opt, logger)
+	client.addr = conn.RemoteAddr().String()
+	return client, nil
 }
 
 func NewHTTPClient(conn net.Conn, opt *Option) (*Client, error) {
@@ -99,6 +126,13 @@ func (client *Client) IsAvailable() bool {
 	return !client.closing && !client.shutdown
 }
 
+// NumPending returns the number of calls waiting for a reply
+func (client *Client) NumPending() int {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return len(client.pending)
+}
+
 func (client *Client) registerCall(call *Call) (uint64, error) {
 	client.mu.Lock()
 	defer client.mu.Unlock()
@@ -108,6 +142,7 @@ func (client *Client) registerCall(call *Call) (uint64, error) {
 	call.Seq = client.seq
 	client.pending[call.Seq] = call
 	client.seq++
+	atomic.AddInt64(&clientPendingCalls, 1)
 	return call.Seq, nil
 }
 
@@ -115,7 +150,10 @@ func (client *Client) removeCall(seq uint64) *Call {
 	client.mu.Lock()
 	defer client.mu.Unlock()
 	call := client.pending[seq]
-	delete(client.pending, seq)
+	if call != nil {
+		delete(client.pending, seq)
+		atomic.AddInt64(&clientPendingCalls, -1)
+	}
 	return call
 }
 
@@ -129,6 +167,8 @@ func (client *Client) terminateCalls(err error) {
 		call.Error = err
 		call.done()
 	}
+	atomic.AddInt64(&clientPendingCalls, -int64(len(client.pending)))
+	client.pending = make(map[uint64]*Call)
 }
 
 func (client *Client) receive() {
@@ -143,7 +183,11 @@ func (client *Client) receive() {
 		case call == nil: // call has been terminated
 			err = client.cc.ReadBody(nil)
 		case h.Error != "": // error from server
-			call.Error = fmt.Errorf(h.Error)
+			code := Code(h.Code)
+			if code == CodeOK { // server didn't classify the error
+				code = CodeUnknown
+			}
+			call.Error = &Error{Code: code, Message: h.Error}
 			err = client.cc.ReadBody(nil)
 			call.done()
 		default: // read response body and notify application
@@ -155,29 +199,30 @@ func (client *Client) receive() {
 		}
 	}
 	// error occurs, terminate calls
+	client.mu.Lock()
+	closing := client.closing
+	client.mu.Unlock()
+	if !closing {
+		client.logger.Warn("rpc client: connection lost", "err", err)
+	}
 	client.terminateCalls(err)
+	close(client.done)
 }
 
+// send writes a registered call to the connection
 func (client *Client) send(call *Call) {
 	client.sending.Lock()
 	defer client.sending.Unlock()
 
-	// register this call
-	seq, err := client.registerCall(call)
-	if err != nil {
-		call.Error = err
-		call.done()
-		return
-	}
-
 	// prepare request header
 	client.header.ServiceMethod = call.ServiceMethod
-	client.header.Seq = seq
+	client.header.Seq = call.Seq
 	client.header.Error = ""
+	client.header.Metadata = call.Metadata
 
 	// encode and send request
 	if err := client.cc.Write(&client.header, call.Args); err != nil {
-		call := client.removeCall(seq) // remove this call
+		call := client.removeCall(call.Seq) // remove this call
 		// call is not nil, because we have registered it before
 		if call != nil {
 			call.Error = err
@@ -188,31 +233,95 @@ func (client *Client) send(call *Call) {
 
 // Go invokes the function asynchronously. It returns the Call structure representing the invocation.
 func (client *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	return client.goWithMetadata(serviceMethod, args, reply, nil, done)
+}
+
+func (client *Client) goWithMetadata(serviceMethod string, args, reply interface{}, md Metadata, done chan *Call) *Call {
 	if done == nil { // make sure done is not nil
 		done = make(chan *Call, 10)
 	} else if cap(done) == 0 { // make sure done has buffer
-		log.Panic("rpc client: done channel is unbuffered")
+		panic("rpc client: done channel is unbuffered")
 	}
 	call := &Call{
 		ServiceMethod: serviceMethod,
 		Args:          args,
 		Reply:         reply,
+		Metadata:      md,
 		Done:          done,
 	}
+	if creds := client.opt.Credentials; creds != nil {
+		var err error
+		if call.Metadata, err = withCredentials(creds, serviceMethod, md); err != nil {
+			call.Error = err
+			call.done()
+			return call
+		}
+	}
+	// register this call before returning, so that the caller can remove it by call.Seq
+	if _, err := client.registerCall(call); err != nil {
+		call.Error = err
+		call.done()
+		return call
+	}
 	go client.send(call)
 	return call
 }
 
 // Call invokes the named function, waits for it to complete, and returns its error status.
+// Metadata attached to ctx by WithMetadata is sent along with the request.
+// If Option.SpanExporter is set, the call is traced as a child of the span in ctx, see SpanFromContext.
+// If Option.RetryPolicy is set, the call is made again on failure as it allows.
 func (client *Client) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	call := client.Go(serviceMethod, args, reply, make(chan *Call, 1))
+	return client.opt.RetryPolicy.Do(ctx, serviceMethod, func() error {
+		return client.call(ctx, serviceMethod, args, reply)
+	})
+}
+
+func (client *Client) call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	start := time.Now()
+	md := metadataFromContext(ctx)
+	parent, hasParent := SpanFromContext(ctx)
+	var span *Span
+	if client.opt.SpanExporter != nil {
+		span = startSpan(SpanKindClient, serviceMethod, client.addr, parent, hasParent)
+		md = md.with(traceparentKey, span.context().traceparent())
+	} else if hasParent { // not traced here, but keep the trace going
+		md = md.with(traceparentKey, parent.traceparent())
+	}
+	call := client.goWithMetadata(serviceMethod, args, reply, md, make(chan *Call, 1))
+	var err error
 	select {
 	case <-ctx.Done(): // context timeout
 		client.removeCall(call.Seq) // remove this call
-		return fmt.Errorf("rpc client: call failed: %s", ctx.Err())
+		err = fmt.Errorf("rpc client: call failed: %s", ctx.Err())
 	case call := <-call.Done: // call is done
-		return call.Error
+		err = call.Error
 	}
+	client.logCall(ctx, call, time.Since(start), err)
+	if span != nil {
+		span.end(client.opt.SpanExporter, err)
+	}
+	return err
+}
+
+// logCall logs a finished call at debug level, or at warn level if it failed
+func (client *Client) logCall(ctx context.Context, call *Call, d time.Duration, err error) {
+	level := slog.LevelDebug
+	if err != nil {
+		level = slog.LevelWarn
+	}
+	if !client.logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.Uint64("seq", call.Seq),
+		slog.String("method", call.ServiceMethod),
+		slog.Duration("duration", d),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("err", err))
+	}
+	client.logger.LogAttrs(ctx, level, "rpc client: call", attrs...)
 }
 
 func parseOptions(opts ...*Option) (*Option, error) { // to make Option optional
@@ -252,7 +361,7 @@ func dialTimeout(f newClientFunc, network, address string, opts ...*Option) (cli
 	}()
 	ch := make(chan clientResult)
 	go func() { // start a goroutine to create client
-		client, err = f(conn, opt)
+		client, err := f(conn, opt)
 		ch <- clientResult{client: client, err: err} // send result to ch
 	}()
 	if opt.ConnectTimeout == 0 { // no timeout
@@ -275,9 +384,34 @@ func DialHTTP(network, address string, opts ...*Option) (client *Client, err err
 	return dialTimeout(NewHTTPClient, network, address, opts...)
 }
 
+// DialTLS connects to a RPC server over TLS. The handshake counts towards Option.ConnectTimeout.
+// If config has no ServerName, the host of address is used to verify the server certificate.
+// Add a client certificate to config.Certificates for mutual TLS.
+func DialTLS(network, address string, config *tls.Config, opts ...*Option) (client *Client, err error) {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			config.ServerName = host
+		} else {
+			config.ServerName = address
+		}
+	}
+	return dialTimeout(func(conn net.Conn, opt *Option) (*Client, error) {
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		return NewClient(tlsConn, opt)
+	}, network, address, opts...)
+}
+
 // XDial calls different functions to connect to a RPC server according to the first parameter rpcAddr.
 // rpcAddr is in the format of "protocol@addr".
-// eg, http@10.0.0.1:7001, tcp@10.0.0.1:9999, unix@/tmp/geerpc.sock
+// eg, http@10.0.0.1:7001, tcp@10.0.0.1:9999, unix@/tmp/geerpc.sock, tls@10.0.0.1:9999
+// tls uses Option.TLSConfig of the given option.
 func XDial(rpcAddr string, opts ...*Option) (*Client, error) {
 	parts := strings.Split(rpcAddr, "@") // split rpcAddr
 	if len(parts) != 2 {
@@ -287,7 +421,39 @@ func XDial(rpcAddr string, opts ...*Option) (*Client, error) {
 	switch protocol {
 	case "http":
 		return DialHTTP("tcp", addr, opts...)
+	case "tls":
+		var config *tls.Config
+		if len(opts) > 0 && opts[0] != nil {
+			config = opts[0].TLSConfig
+		}
+		return DialTLS("tcp", addr, config, opts...)
 	default:
 		return Dial(protocol, addr, opts...)
 	}
 }
+
+// ParseWeightedAddr splits a server entry of a discovery or registry, an address accepted by XDial optionally
+// followed by ";weight=N", e.g. tcp@10.0.0.1:9999;weight=3, into the address and its weight, 1 if not set.
+// The weight is 1 if the entry is invalid.
+func ParseWeightedAddr(entry string) (rpcAddr string, weight int, err error) {
+	rpcAddr, attr, ok := strings.Cut(entry, ";")
+	if !ok {
+		return rpcAddr, 1, nil
+	}
+	value, ok := strings.CutPrefix(attr, "weight=")
+	if !ok {
+		return rpcAddr, 1, fmt.Errorf("rpc: unknown attribute %q of server %s", attr, rpcAddr)
+	}
+	if weight, err = strconv.Atoi(value); err != nil || weight < 1 {
+		return rpcAddr, 1, fmt.Errorf("rpc: invalid weight %q of server %s", value, rpcAddr)
+	}
+	return rpcAddr, weight, nil
+}
+
+// WeightedAddr returns the server entry of rpcAddr with weight, as parsed by ParseWeightedAddr
+func WeightedAddr(rpcAddr string, weight int) string {
+	if weight == 1 {
+		return rpcAddr
+	}
+	return rpcAddr + ";weight=" + strconv.Itoa(weight)
+}
@@ -56,10 +56,12 @@ func TestClient_Call(t *testing.T) {
 	t.Run("client timeout", func(t *testing.T) {
 		client, _ := Dial("tcp", addr)
 		defer func() { _ = client.Close() }()
-		ctx, _ := context.WithTimeout(context.Background(), time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
 		var reply int
 		err := client.Call(ctx, "Bar.Timeout", 1, &reply)
 		_assert(err != nil && strings.Contains(err.Error(), ctx.Err().Error()), "expect a timeout error")
+		_assert(client.NumPending() == 0, "expect the timed out call to be removed, got %d pending", client.NumPending())
 	})
 	t.Run("server handle timeout", func(t *testing.T) {
 		client, _ := Dial("tcp", addr, &Option{HandleTimeout: time.Second, MagicNumber: MagicNumber}) // if MagicNumber is not set, the client will not send the option struct to the server
@@ -87,7 +89,9 @@ func TestXDial(t *testing.T) {
 			_ = os.Remove(addr)
 			l, err := net.Listen("unix", addr)
 			if err != nil {
-				t.Fatal("failed to listen unix socket", err)
+				t.Error("failed to listen unix socket", err)
+				close(ch)
+				return
 			}
 			ch <- struct{}{}
 			Accept(l) // 假设这是你的自定义函数
@@ -98,3 +102,25 @@ func TestXDial(t *testing.T) {
 		_assert(err == nil, "XDial unix socket error: %v", err)         // 假设_assert是你的自定义断言函数
 	}
 }
+
+func TestParseWeightedAddr(t *testing.T) {
+	tests := []struct {
+		entry  string
+		addr   string
+		weight int
+		ok     bool
+	}{
+		{"tcp@10.0.0.1:9999", "tcp@10.0.0.1:9999", 1, true},
+		{"tcp@10.0.0.1:9999;weight=3", "tcp@10.0.0.1:9999", 3, true},
+		{"unix@/tmp/geerpc.sock;weight=0", "unix@/tmp/geerpc.sock", 1, false},
+		{"tcp@10.0.0.1:9999;zone=a", "tcp@10.0.0.1:9999", 1, false},
+	}
+	for _, tt := range tests {
+		addr, weight, err := ParseWeightedAddr(tt.entry)
+		_assert(addr == tt.addr && weight == tt.weight && (err == nil) == tt.ok,
+			"%s: expect %s %d, got %s %d %v", tt.entry, tt.addr, tt.weight, addr, weight, err)
+		if tt.ok {
+			_assert(WeightedAddr(addr, weight) == tt.entry, "expect %s to be formatted back", tt.entry)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+// Command geerpc-bench generates load against a GeeRPC server and reports throughput, latency percentiles and errors.
+// Without -addr it starts a server in process, -compare also runs the same load against net/rpc.
+//
+// Usage:
+//
+//	geerpc-bench -c 50 -d 10s -size 1024 -codec json -transport unix
+//	geerpc-bench -c 10 -qps 2000 -compare
+//	geerpc-bench -serve tcp@:9999                          # serve the Bench service for remote runs
+//	geerpc-bench -addr tcp@server:9999 -c 100 -d 30s
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"geerpc"
+	"geerpc/codec"
+	"io"
+	"net"
+	"net/http"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bench is the service called by the load generator
+type Bench int
+
+// Echo replies the payload it is sent
+func (b Bench) Echo(payload []byte, reply *[]byte) error {
+	*reply = payload
+	return nil
+}
+
+var codecs = map[string]codec.Type{"gob": codec.GobType, "json": codec.JsonType}
+
+type config struct {
+	addr        string
+	transport   string
+	codec       codec.Type
+	concurrency int
+	qps         int
+	size        int
+	duration    time.Duration
+	timeout     time.Duration
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command line args and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("geerpc-bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var cfg config
+	fs.StringVar(&cfg.addr, "addr", "", "XDial address of a server running the Bench service, empty starts one in process")
+	fs.StringVar(&cfg.transport, "transport", "tcp", "transport of the in-process server, tcp, http or unix")
+	codecName := fs.String("codec", "gob", "codec, gob or json")
+	fs.IntVar(&cfg.concurrency, "c", 10, "number of concurrent callers, sharing one connection")
+	fs.IntVar(&cfg.qps, "qps", 0, "target calls per second of all callers, 0 means as fast as possible")
+	fs.IntVar(&cfg.size, "size", 64, "payload size in bytes")
+	fs.DurationVar(&cfg.duration, "d", time.Second*10, "duration of the load")
+	fs.DurationVar(&cfg.timeout, "timeout", time.Second, "timeout of every call")
+	compare := fs.Bool("compare", false, "also run the load against net/rpc over tcp")
+	serve := fs.String("serve", "", "only serve the Bench service on this XDial style address, e.g. tcp@:9999")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	var ok bool
+	if cfg.codec, ok = codecs[*codecName]; !ok || cfg.concurrency < 1 || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	if *serve != "" {
+		network, addr, _ := strings.Cut(*serve, "@")
+		l, err := listen(network, addr)
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, "geerpc-bench:", err)
+			return 1
+		}
+		_, _ = fmt.Fprintln(stdout, "serving Bench on", l.Addr())
+		serveGeeRPC(network, l)
+		return 0
+	}
+
+	report, err := runGeeRPC(cfg)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "geerpc-bench:", err)
+		return 1
+	}
+	report.print(stdout)
+	if *compare {
+		if report, err = runNetRPC(cfg); err != nil {
+			_, _ = fmt.Fprintln(stderr, "geerpc-bench:", err)
+			return 1
+		}
+		report.print(stdout)
+	}
+	return 0
+}
+
+func listen(network, addr string) (net.Listener, error) {
+	if network == "http" {
+		network = "tcp"
+	}
+	return net.Listen(network, addr)
+}
+
+func serveGeeRPC(network string, l net.Listener) {
+	s := geerpc.NewServer()
+	_ = s.Register(new(Bench))
+	if network == "http" {
+		_ = http.Serve(l, s) // the server accepts CONNECT on any path
+		return
+	}
+	s.Accept(l)
+}
+
+// startGeeRPC starts an in-process server on the transport and returns its XDial address
+func startGeeRPC(transport string) (string, func(), error) {
+	network, addr := transport, ":0"
+	if transport == "unix" {
+		dir, err := os.MkdirTemp("", "geerpc-bench")
+		if err != nil {
+			return "", nil, err
+		}
+		addr = filepath.Join(dir, "bench.sock")
+	} else if transport != "tcp" && transport != "http" {
+		return "", nil, fmt.Errorf("unknown transport %q", transport)
+	}
+	l, err := listen(network, addr)
+	if err != nil {
+		return "", nil, err
+	}
+	go serveGeeRPC(network, l)
+	stop := func() {
+		_ = l.Close()
+		if transport == "unix" {
+			_ = os.RemoveAll(filepath.Dir(addr))
+		}
+	}
+	return transport + "@" + l.Addr().String(), stop, nil
+}
+
+func runGeeRPC(cfg config) (*report, error) {
+	addr := cfg.addr
+	transport := cfg.transport
+	if addr == "" {
+		var stop func()
+		var err error
+		if addr, stop, err = startGeeRPC(cfg.transport); err != nil {
+			return nil, err
+		}
+		defer stop()
+	} else {
+		transport, _, _ = strings.Cut(addr, "@")
+	}
+	client, err := geerpc.XDial(addr, &geerpc.Option{MagicNumber: geerpc.MagicNumber, CodecType: cfg.codec, ConnectTimeout: cfg.timeout})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = client.Close() }()
+	payload := make([]byte, cfg.size)
+	name := fmt.Sprintf("geerpc %s %s", transport, strings.TrimPrefix(string(cfg.codec), "application/"))
+	return load(name, cfg, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+		defer cancel()
+		var reply []byte
+		return client.Call(ctx, "Bench.Echo", payload, &reply)
+	}), nil
+}
+
+func runNetRPC(cfg config) (*report, error) {
+	s := rpc.NewServer()
+	_ = s.Register(new(Bench))
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = l.Close() }()
+	go func() {
+		for { // not s.Accept, which logs the error of closing l
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.ServeConn(conn)
+		}
+	}()
+	client, err := rpc.Dial("tcp", l.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = client.Close() }()
+	payload := make([]byte, cfg.size)
+	return load("net/rpc tcp gob", cfg, func() error {
+		var reply []byte
+		call := client.Go("Bench.Echo", payload, &reply, make(chan *rpc.Call, 1))
+		select {
+		case <-time.After(cfg.timeout):
+			return errors.New("timeout")
+		case call = <-call.Done:
+			return call.Error
+		}
+	}), nil
+}
+
+// load makes calls from cfg.concurrency goroutines for cfg.duration, paced to cfg.qps if set
+func load(name string, cfg config, call func() error) *report {
+	var mu sync.Mutex
+	r := &report{name: name, errors: make(map[string]int)}
+	var wg sync.WaitGroup
+	start := time.Now()
+	deadline := start.Add(cfg.duration)
+	for i := 0; i < cfg.concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var interval time.Duration
+			next := start
+			if cfg.qps > 0 {
+				interval = time.Second * time.Duration(cfg.concurrency) / time.Duration(cfg.qps)
+				next = start.Add(interval * time.Duration(i) / time.Duration(cfg.concurrency)) // spread the callers
+			}
+			var latencies []time.Duration
+			errs := make(map[string]int)
+			for {
+				if interval > 0 {
+					time.Sleep(time.Until(next))
+					next = next.Add(interval)
+				}
+				if time.Now().After(deadline) {
+					break
+				}
+				callStart := time.Now()
+				err := call()
+				latencies = append(latencies, time.Since(callStart))
+				if err != nil {
+					errs[errorClass(err)]++
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			r.latencies = append(r.latencies, latencies...)
+			for class, n := range errs {
+				r.errors[class] += n
+			}
+		}(i)
+	}
+	wg.Wait()
+	r.elapsed = time.Since(start)
+	return r
+}
+
+// errorClass groups errors by their GeeRPC code, other errors by message
+func errorClass(err error) string {
+	var e *geerpc.Error
+	if errors.As(err, &e) {
+		return e.Code.String()
+	}
+	return err.Error()
+}
+
+type report struct {
+	name      string
+	elapsed   time.Duration
+	latencies []time.Duration
+	errors    map[string]int // by errorClass
+}
+
+// percentile returns the latency below which p percent of the calls finished, latencies must be sorted
+func (r *report) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.latencies))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(r.latencies) {
+		i = len(r.latencies) - 1
+	}
+	return r.latencies[i]
+}
+
+func (r *report) print(w io.Writer) {
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	calls := len(r.latencies)
+	var failed int
+	for _, n := range r.errors {
+		failed += n
+	}
+	var rate float64
+	if calls > 0 {
+		rate = float64(failed) * 100 / float64(calls)
+	}
+	_, _ = fmt.Fprintf(w, "%s: %d calls in %s, %.1f calls/s, %d errors (%.2f%%)\n",
+		r.name, calls, r.elapsed.Round(time.Millisecond), float64(calls)/r.elapsed.Seconds(), failed, rate)
+	_, _ = fmt.Fprintf(w, "  latency p50 %s, p90 %s, p99 %s, p99.9 %s, max %s\n",
+		r.percentile(50), r.percentile(90), r.percentile(99), r.percentile(99.9), r.percentile(100))
+	classes := make([]string, 0, len(r.errors))
+	for class := range r.errors {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		_, _ = fmt.Fprintf(w, "  %d errors: %s\n", r.errors[class], class)
+	}
+}
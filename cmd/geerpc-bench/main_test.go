@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	for _, args := range [][]string{
+		{"-d", "100ms", "-c", "4"},
+		{"-d", "100ms", "-transport", "unix", "-codec", "json", "-size", "1024"},
+		{"-d", "100ms", "-transport", "http", "-compare"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := run(args, &stdout, &stderr); code != 0 {
+			t.Fatalf("%v: expect exit code 0, got %d: %s", args, code, stderr.String())
+		}
+		out := stdout.String()
+		if !strings.Contains(out, " 0 errors (0.00%)") || !strings.Contains(out, "latency p50 ") {
+			t.Errorf("%v: expect a report without errors, got:\n%s", args, out)
+		}
+		if strings.Contains(strings.Join(args, " "), "-compare") && !strings.Contains(out, "net/rpc tcp gob: ") {
+			t.Errorf("%v: expect a net/rpc report, got:\n%s", args, out)
+		}
+	}
+}
+
+func TestLoad_QPS(t *testing.T) {
+	cfg := config{concurrency: 5, qps: 200, duration: time.Millisecond * 500}
+	r := load("test", cfg, func() error { return nil })
+	if n := len(r.latencies); n < 80 || n > 110 {
+		t.Errorf("expect about 100 calls at 200 qps in 500ms, got %d", n)
+	}
+}
@@ -0,0 +1,47 @@
+// Package example shows the clients generated by geerpc-gen for a service type and a service interface
+package example
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+//go:generate go run geerpc/cmd/geerpc-gen -type Arith
+//go:generate go run geerpc/cmd/geerpc-gen -type Clock -service Time
+
+type Args struct {
+	A, B int
+}
+
+type Quotient struct {
+	Quo, Rem int
+}
+
+type Arith int
+
+// Multiply returns A times B
+func (t *Arith) Multiply(args *Args, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+func (t *Arith) Divide(ctx context.Context, args Args, quo *Quotient) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	quo.Quo, quo.Rem = args.A/args.B, args.A%args.B
+	return nil
+}
+
+// Reset isn't a service method, it doesn't take a reply
+func (t *Arith) Reset() error {
+	return nil
+}
+
+// Clock describes the Time service
+type Clock interface {
+	// Now returns the current time in the location
+	Now(ctx context.Context, location string, now *time.Time) error
+	Since(start time.Time, d *time.Duration) error
+}
@@ -0,0 +1,39 @@
+// Code generated by geerpc-gen -type Arith; DO NOT EDIT.
+
+package example
+
+import (
+	"context"
+	"geerpc"
+)
+
+// ArithClient is a typed client of the Arith service
+type ArithClient struct {
+	c geerpc.Caller
+}
+
+// NewArithClient returns a client of the Arith service making its calls with c, e.g. a *geerpc.Client or *xclient.XClient
+func NewArithClient(c geerpc.Caller) *ArithClient {
+	return &ArithClient{c: c}
+}
+
+// Divide calls Arith.Divide(Args, *Quotient) error
+func (c *ArithClient) Divide(ctx context.Context, args Args) (Quotient, error) {
+	var reply Quotient
+	err := c.c.Call(ctx, "Arith.Divide", args, &reply)
+	return reply, err
+}
+
+// Multiply calls Arith.Multiply(*Args, *int) error
+//
+// Multiply returns A times B
+func (c *ArithClient) Multiply(ctx context.Context, args *Args) (int, error) {
+	var reply int
+	err := c.c.Call(ctx, "Arith.Multiply", args, &reply)
+	return reply, err
+}
+
+// RegisterArith registers rcvr as the Arith service on s
+func RegisterArith(s *geerpc.Server, rcvr *Arith, opts ...geerpc.ServiceOption) error {
+	return s.Register(rcvr, append([]geerpc.ServiceOption{geerpc.WithServiceName("Arith")}, opts...)...)
+}
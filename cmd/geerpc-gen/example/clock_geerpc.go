@@ -0,0 +1,40 @@
+// Code generated by geerpc-gen -type Clock; DO NOT EDIT.
+
+package example
+
+import (
+	"context"
+	"geerpc"
+	"time"
+)
+
+// ClockClient is a typed client of the Time service
+type ClockClient struct {
+	c geerpc.Caller
+}
+
+// NewClockClient returns a client of the Time service making its calls with c, e.g. a *geerpc.Client or *xclient.XClient
+func NewClockClient(c geerpc.Caller) *ClockClient {
+	return &ClockClient{c: c}
+}
+
+// Now calls Time.Now(string, *time.Time) error
+//
+// Now returns the current time in the location
+func (c *ClockClient) Now(ctx context.Context, args string) (time.Time, error) {
+	var reply time.Time
+	err := c.c.Call(ctx, "Time.Now", args, &reply)
+	return reply, err
+}
+
+// Since calls Time.Since(time.Time, *time.Duration) error
+func (c *ClockClient) Since(ctx context.Context, args time.Time) (time.Duration, error) {
+	var reply time.Duration
+	err := c.c.Call(ctx, "Time.Since", args, &reply)
+	return reply, err
+}
+
+// RegisterClock registers impl as the Time service on s
+func RegisterClock(s *geerpc.Server, impl Clock, opts ...geerpc.ServiceOption) error {
+	return s.Register(impl, append([]geerpc.ServiceOption{geerpc.WithServiceName("Time")}, opts...)...)
+}
@@ -0,0 +1,68 @@
+package example
+
+import (
+	"context"
+	"geerpc"
+	"geerpc/xclient"
+	"net"
+	"testing"
+	"time"
+)
+
+type clock struct{}
+
+func (clock) Now(_ context.Context, location string, now *time.Time) error {
+	loc, err := time.LoadLocation(location)
+	if err != nil {
+		return err
+	}
+	*now = time.Now().In(loc)
+	return nil
+}
+
+func (clock) Since(start time.Time, d *time.Duration) error {
+	*d = time.Since(start)
+	return nil
+}
+
+func TestGeneratedClients(t *testing.T) {
+	s := geerpc.NewServer()
+	if err := RegisterArith(s, new(Arith)); err != nil {
+		t.Fatal("register error:", err)
+	}
+	if err := RegisterClock(s, clock{}); err != nil {
+		t.Fatal("register error:", err)
+	}
+	l, _ := net.Listen("tcp", ":0")
+	go s.Accept(l)
+	defer func() { _ = l.Close() }()
+
+	client, err := geerpc.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("dial error:", err)
+	}
+	defer func() { _ = client.Close() }()
+	ctx := context.Background()
+
+	arith := NewArithClient(client)
+	if product, err := arith.Multiply(ctx, &Args{A: 6, B: 7}); err != nil || product != 42 {
+		t.Fatal("expect 42, got", product, err)
+	}
+	if _, err := arith.Divide(ctx, Args{A: 1}); err == nil {
+		t.Fatal("expect the error of the service")
+	}
+
+	xc := xclient.NewXClient(xclient.NewMultiServerDiscovery([]string{"tcp@" + l.Addr().String()}), xclient.RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	if quo, err := NewArithClient(xc).Divide(ctx, Args{A: 7, B: 2}); err != nil || quo != (Quotient{Quo: 3, Rem: 1}) {
+		t.Fatal("expect 3 remainder 1, got", quo, err)
+	}
+
+	c := NewClockClient(xc)
+	if now, err := c.Now(ctx, "UTC"); err != nil || now.Location().String() != "UTC" {
+		t.Fatal("expect the time in UTC, got", now, err)
+	}
+	if d, err := c.Since(ctx, time.Now().Add(-time.Hour)); err != nil || d < time.Hour {
+		t.Fatal("expect at least an hour, got", d, err)
+	}
+}
@@ -0,0 +1,348 @@
+// Command geerpc-gen generates a typed client and a registration helper for a GeeRPC service, e.g.
+//
+//	//go:generate geerpc-gen -type Arith
+//
+// next to the service type Arith writes arith_geerpc.go with
+//
+//	func NewArithClient(c geerpc.Caller) *ArithClient
+//	func (c *ArithClient) Multiply(ctx context.Context, args *Args) (int, error)
+//	func RegisterArith(s *geerpc.Server, rcvr *Arith, opts ...geerpc.ServiceOption) error
+//
+// -type can also name an interface describing the service, RegisterArith then takes any implementation of it.
+// Methods are picked like Server.Register does: exported, (ctx context.Context,) args, *reply, returning error,
+// with exported or builtin args and reply types. Methods promoted from embedded types are not seen.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// run runs the command line args and returns the exit code
+func run(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("geerpc-gen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	typeName := fs.String("type", "", "service type or interface to generate a client for")
+	serviceName := fs.String("service", "", "name the service is registered under, default the type name")
+	dir := fs.String("dir", ".", "directory of the package declaring the type")
+	output := fs.String("output", "", "output file, default <type>_geerpc.go in dir")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *typeName == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	if *serviceName == "" {
+		*serviceName = *typeName
+	}
+	if *output == "" {
+		*output = filepath.Join(*dir, strings.ToLower(*typeName)+"_geerpc.go")
+	}
+	src, err := generate(*dir, *typeName, *serviceName)
+	if err == nil {
+		err = os.WriteFile(*output, src, 0o644)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "geerpc-gen:", err)
+		return 1
+	}
+	return 0
+}
+
+type method struct {
+	Name      string
+	Args      string // type of the args
+	Reply     string // type of the reply, without the pointer
+	Doc       string
+	Signature string // of the service method, for the doc comment
+}
+
+type service struct {
+	Package   string
+	Type      string
+	Service   string
+	Interface bool
+	Imports   []string
+	Methods   []method
+	Skipped   []string
+}
+
+// generate parses the package in dir and returns the source of the client of typeName
+func generate(dir, typeName, serviceName string) ([]byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && !strings.HasSuffix(fi.Name(), "_geerpc.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		svc, err := newService(fset, pkg, typeName)
+		if err != nil {
+			return nil, err
+		}
+		if svc == nil {
+			continue
+		}
+		svc.Service = serviceName
+		var buf bytes.Buffer
+		if err := clientTemplate.Execute(&buf, svc); err != nil {
+			return nil, err
+		}
+		return format.Source(buf.Bytes())
+	}
+	return nil, fmt.Errorf("can't find type %s in %s", typeName, dir)
+}
+
+// newService collects the methods of typeName in pkg, it returns nil if pkg doesn't declare typeName
+func newService(fset *token.FileSet, pkg *ast.Package, typeName string) (*service, error) {
+	svc := &service{Package: pkg.Name, Type: typeName}
+	imports := make(map[string]bool)
+	found := false
+	fileNames := make([]string, 0, len(pkg.Files))
+	for name := range pkg.Files {
+		fileNames = append(fileNames, name)
+	}
+	sort.Strings(fileNames)
+	for _, name := range fileNames {
+		file := pkg.Files[name]
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					ts, ok := spec.(*ast.TypeSpec)
+					if !ok || ts.Name.Name != typeName {
+						continue
+					}
+					found = true
+					if it, ok := ts.Type.(*ast.InterfaceType); ok {
+						svc.Interface = true
+						for _, field := range it.Methods.List {
+							ft, ok := field.Type.(*ast.FuncType)
+							if !ok || len(field.Names) == 0 {
+								continue
+							}
+							svc.add(fset, file, field.Names[0].Name, ft, field.Doc, imports)
+						}
+					}
+				}
+			case *ast.FuncDecl:
+				if decl.Recv == nil || len(decl.Recv.List) != 1 || receiverName(decl.Recv.List[0].Type) != typeName {
+					continue
+				}
+				svc.add(fset, file, decl.Name.Name, decl.Type, decl.Doc, imports)
+			}
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	if len(svc.Methods) == 0 {
+		return nil, fmt.Errorf("type %s has no methods suitable for a service, skipped: %s", typeName, strings.Join(svc.Skipped, ", "))
+	}
+	sort.Slice(svc.Methods, func(i, j int) bool { return svc.Methods[i].Name < svc.Methods[j].Name })
+	for path := range imports {
+		svc.Imports = append(svc.Imports, path)
+	}
+	sort.Strings(svc.Imports)
+	return svc, nil
+}
+
+func receiverName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// params flattens the fields of a parameter list, e.g. (a, b int) is two params
+func params(fields *ast.FieldList) []ast.Expr {
+	if fields == nil {
+		return nil
+	}
+	var exprs []ast.Expr
+	for _, field := range fields.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			exprs = append(exprs, field.Type)
+		}
+	}
+	return exprs
+}
+
+func isSelector(expr ast.Expr, pkg, name string) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	return ok && x.Name == pkg && sel.Sel.Name == name
+}
+
+// isExportedOrBuiltinType is the syntactic version of the check done by registerMethods:
+// named types must be exported or builtin, unnamed types like pointers and slices are accepted.
+func isExportedOrBuiltinType(expr ast.Expr) bool {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return ast.IsExported(expr.Name) || isBuiltin(expr.Name)
+	case *ast.SelectorExpr:
+		return ast.IsExported(expr.Sel.Name)
+	default:
+		return true
+	}
+}
+
+func isBuiltin(name string) bool {
+	switch name {
+	case "bool", "string", "error", "any", "byte", "rune", "uintptr",
+		"int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64",
+		"float32", "float64", "complex64", "complex128":
+		return true
+	}
+	return false
+}
+
+// add adds the method if registerMethods would register it, and records why not otherwise
+func (svc *service) add(fset *token.FileSet, file *ast.File, name string, ft *ast.FuncType, doc *ast.CommentGroup, imports map[string]bool) {
+	if !ast.IsExported(name) {
+		return
+	}
+	in, out := params(ft.Params), params(ft.Results)
+	if len(in) == 3 && isSelector(in[0], "context", "Context") {
+		in = in[1:]
+	}
+	var reply *ast.StarExpr
+	isPtr := false
+	if len(in) > 0 {
+		reply, isPtr = in[len(in)-1].(*ast.StarExpr)
+	}
+	switch {
+	case len(in) != 2 || len(out) != 1:
+		svc.Skipped = append(svc.Skipped, name+" (wrong number of ins or outs)")
+	case !isIdent(out[0], "error"):
+		svc.Skipped = append(svc.Skipped, name+" (doesn't return error)")
+	case !isPtr:
+		svc.Skipped = append(svc.Skipped, name+" (reply isn't a pointer)")
+	case !isExportedOrBuiltinType(in[0]) || !isExportedOrBuiltinType(in[1]):
+		svc.Skipped = append(svc.Skipped, name+" (args or reply type not exported)")
+	default:
+		for _, expr := range []ast.Expr{in[0], reply.X} {
+			ast.Inspect(expr, func(n ast.Node) bool {
+				if sel, ok := n.(*ast.SelectorExpr); ok {
+					if x, ok := sel.X.(*ast.Ident); ok {
+						if path := importPath(file, x.Name); path != "" {
+							imports[path] = true
+						}
+					}
+				}
+				return true
+			})
+		}
+		m := method{Name: name, Args: exprString(fset, in[0]), Reply: exprString(fset, reply.X)}
+		m.Signature = fmt.Sprintf("%s(%s, *%s) error", name, m.Args, m.Reply)
+		if doc != nil {
+			m.Doc = strings.TrimSpace(doc.Text())
+		}
+		svc.Methods = append(svc.Methods, m)
+	}
+}
+
+func isIdent(expr ast.Expr, name string) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == name
+}
+
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, fset, expr)
+	return buf.String()
+}
+
+// importPath returns the path of the package imported as name in file
+func importPath(file *ast.File, name string) string {
+	for _, imp := range file.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		if imp.Name != nil {
+			if imp.Name.Name == name {
+				return path
+			}
+			continue
+		}
+		if path == name || strings.HasSuffix(path, "/"+name) {
+			return path
+		}
+	}
+	return ""
+}
+
+var clientTemplate = template.Must(template.New("client").Funcs(template.FuncMap{
+	"comment": func(s string) string { return strings.ReplaceAll(s, "\n", "\n// ") },
+}).Parse(`// Code generated by geerpc-gen -type {{.Type}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+	"geerpc"
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+)
+
+// {{.Type}}Client is a typed client of the {{.Service}} service
+type {{.Type}}Client struct {
+	c geerpc.Caller
+}
+
+// New{{.Type}}Client returns a client of the {{.Service}} service making its calls with c, e.g. a *geerpc.Client or *xclient.XClient
+func New{{.Type}}Client(c geerpc.Caller) *{{.Type}}Client {
+	return &{{.Type}}Client{c: c}
+}
+{{range .Methods}}
+// {{.Name}} calls {{$.Service}}.{{.Signature}}
+{{- if .Doc}}
+//
+// {{comment .Doc}}
+{{- end}}
+func (c *{{$.Type}}Client) {{.Name}}(ctx context.Context, args {{.Args}}) ({{.Reply}}, error) {
+	var reply {{.Reply}}
+	err := c.c.Call(ctx, "{{$.Service}}.{{.Name}}", args, &reply)
+	return reply, err
+}
+{{end}}
+{{- if .Interface}}
+// Register{{.Type}} registers impl as the {{.Service}} service on s
+func Register{{.Type}}(s *geerpc.Server, impl {{.Type}}, opts ...geerpc.ServiceOption) error {
+	return s.Register(impl, append([]geerpc.ServiceOption{geerpc.WithServiceName("{{.Service}}")}, opts...)...)
+}
+{{- else}}
+// Register{{.Type}} registers rcvr as the {{.Service}} service on s
+func Register{{.Type}}(s *geerpc.Server, rcvr *{{.Type}}, opts ...geerpc.ServiceOption) error {
+	return s.Register(rcvr, append([]geerpc.ServiceOption{geerpc.WithServiceName("{{.Service}}")}, opts...)...)
+}
+{{- end}}
+`))
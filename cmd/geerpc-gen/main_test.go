@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGenerate checks that the generated files of the example are up to date
+func TestGenerate(t *testing.T) {
+	for _, tc := range []struct{ typ, service, file string }{
+		{"Arith", "Arith", "arith_geerpc.go"},
+		{"Clock", "Time", "clock_geerpc.go"},
+	} {
+		src, err := generate("example", tc.typ, tc.service)
+		if err != nil {
+			t.Fatalf("%s: generate error: %v", tc.typ, err)
+		}
+		want, _ := os.ReadFile(filepath.Join("example", tc.file))
+		if !bytes.Equal(src, want) {
+			t.Errorf("%s: example/%s is out of date, run go generate, got:\n%s", tc.typ, tc.file, src)
+		}
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "svc.go"), []byte(`package svc
+
+type Bad int
+
+func (b Bad) NoReply(args int) error { return nil }
+func (b Bad) NotPointer(args int, reply int) error { return nil }
+func (b Bad) Unexported(args secret, reply *int) error { return nil }
+
+type secret int
+`), 0o644)
+	for _, tc := range []struct {
+		args   []string
+		code   int
+		stderr string
+	}{
+		{[]string{"-dir", dir, "-type", "Bad"}, 1, "NoReply (wrong number of ins or outs), NotPointer (reply isn't a pointer), Unexported (args or reply type not exported)"},
+		{[]string{"-dir", dir, "-type", "Missing"}, 1, "can't find type Missing"},
+		{[]string{"-dir", dir}, 2, "Usage"},
+	} {
+		var stderr bytes.Buffer
+		if code := run(tc.args, &stderr); code != tc.code || !strings.Contains(stderr.String(), tc.stderr) {
+			t.Errorf("%v: expect %d %q, got %d %q", tc.args, tc.code, tc.stderr, code, stderr.String())
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Command geerpc lists the services of a GeeRPC server through reflection and calls their methods with JSON arguments.
+//
+// Usage:
+//
+//	geerpc -addr tcp@localhost:9999 list
+//	geerpc -addr tcp@localhost:9999 describe Foo
+//	geerpc -addr tcp@localhost:9999 -n 3 -md user=alice call Foo.Sum '{"Num1": 1, "Num2": 2}'
+//	geerpc -registry http://localhost:9999/_geerpc_/registry call Foo.Sum '{"Num1": 1, "Num2": 2}'
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"geerpc"
+	"geerpc/codec"
+	"geerpc/xclient"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// metadataFlag collects repeated -md key=value flags
+type metadataFlag geerpc.Metadata
+
+func (f metadataFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f metadataFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expect key=value, got %q", s)
+	}
+	f[k] = v
+	return nil
+}
+
+var codecs = map[string]codec.Type{"gob": codec.GobType, "json": codec.JsonType}
+
+const usage = `usage: geerpc [flags] command
+
+commands:
+  list                          list the services of the server
+  describe Service              show the methods of a service and the types they take
+  call Service.Method [args]    call a method with JSON args and print the JSON reply
+
+flags:
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command line args and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("geerpc", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	md := make(metadataFlag)
+	addr := fs.String("addr", "", "server address as accepted by XDial, e.g. tcp@localhost:9999, http@localhost:9999 or unix@/tmp/geerpc.sock")
+	registry := fs.String("registry", "", "registry URL to pick a server from instead of -addr")
+	timeout := fs.Duration("timeout", time.Second*5, "timeout of connecting and of every call")
+	codecName := fs.String("codec", "gob", "codec, gob or json")
+	n := fs.Int("n", 1, "number of times to make the call")
+	fs.Var(md, "md", "metadata key=value sent with every call, can be repeated")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	codecType, ok := codecs[*codecName]
+	if fs.NArg() == 0 || !ok || (*addr == "") == (*registry == "") {
+		fs.Usage()
+		return 2
+	}
+
+	client, err := dial(*addr, *registry, &geerpc.Option{
+		MagicNumber:    geerpc.MagicNumber,
+		CodecType:      codecType,
+		ConnectTimeout: *timeout,
+	})
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "geerpc:", err)
+		return 1
+	}
+	defer func() { _ = client.Close() }()
+	c := &cli{client: client, timeout: *timeout, md: geerpc.Metadata(md), stdout: stdout, stderr: stderr}
+
+	switch cmd := fs.Arg(0); {
+	case cmd == "list" && fs.NArg() == 1:
+		err = c.list()
+	case cmd == "describe" && fs.NArg() == 2:
+		err = c.describe(fs.Arg(1))
+	case cmd == "call" && (fs.NArg() == 2 || fs.NArg() == 3):
+		err = c.call(fs.Arg(1), fs.Arg(2), *n)
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "geerpc:", err)
+		return 1
+	}
+	return 0
+}
+
+// dial connects to addr, or to a server picked from the registry
+func dial(addr, registry string, opt *geerpc.Option) (*geerpc.Client, error) {
+	if registry != "" {
+		var err error
+		if addr, err = xclient.NewGeeRegistryDiscovery(registry, 0).Get(xclient.RandomSelect); err != nil {
+			return nil, err
+		}
+	}
+	return geerpc.XDial(addr, opt)
+}
+
+type cli struct {
+	client  *geerpc.Client
+	timeout time.Duration
+	md      geerpc.Metadata
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+func (c *cli) invoke(serviceMethod string, args, reply interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	if len(c.md) > 0 {
+		ctx = geerpc.WithMetadata(ctx, c.md)
+	}
+	return c.client.Call(ctx, serviceMethod, args, reply)
+}
+
+func (c *cli) list() error {
+	var names []string
+	if err := c.invoke(geerpc.ReflectionService+".ListServices", 0, &names); err != nil {
+		return err
+	}
+	for _, name := range names {
+		_, _ = fmt.Fprintln(c.stdout, name)
+	}
+	return nil
+}
+
+func (c *cli) service(name string) (*geerpc.ServiceDescriptor, error) {
+	var desc geerpc.ServiceDescriptor
+	if err := c.invoke(geerpc.ReflectionService+".DescribeService", name, &desc); err != nil {
+		return nil, err
+	}
+	return &desc, nil
+}
+
+func (c *cli) describe(name string) error {
+	desc, err := c.service(name)
+	if err != nil {
+		return err
+	}
+	structs := make(map[string]bool)
+	for _, m := range desc.Methods {
+		_, _ = fmt.Fprintf(c.stdout, "%s.%s(%s) %s\n", desc.Name, m.Name, m.ArgType, m.ReplyType)
+	}
+	for _, m := range desc.Methods {
+		c.printStructs(m.ArgType, structs)
+		c.printStructs(m.ReplyType, structs)
+	}
+	return nil
+}
+
+// printStructs prints the definitions of the named structs in ts which aren't in printed yet
+func (c *cli) printStructs(ts *geerpc.TypeSchema, printed map[string]bool) {
+	if ts == nil {
+		return
+	}
+	if ts.Kind == reflect.Struct.String() && ts.Name != "" && !printed[ts.Name] && len(ts.Fields) > 0 {
+		printed[ts.Name] = true
+		unnamed := *ts
+		unnamed.Name = ""
+		_, _ = fmt.Fprintf(c.stdout, "type %s %s\n", ts.Name, &unnamed)
+	}
+	c.printStructs(ts.Elem, printed)
+	c.printStructs(ts.Key, printed)
+	for _, f := range ts.Fields {
+		c.printStructs(f.Type, printed)
+	}
+}
+
+// call makes the call n times, printing every reply as one line of JSON, and a summary to stderr if n > 1
+func (c *cli) call(serviceMethod, args string, n int) error {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return fmt.Errorf("expect Service.Method, got %q", serviceMethod)
+	}
+	desc, err := c.service(serviceMethod[:dot])
+	if err != nil {
+		return err
+	}
+	m := desc.Method(serviceMethod[dot+1:])
+	if m == nil {
+		return fmt.Errorf("can't find method %s", serviceMethod)
+	}
+	argType, err := m.ArgType.Type()
+	if err != nil {
+		return err
+	}
+	replyType, err := m.ReplyType.Type()
+	if err != nil {
+		return err
+	}
+	if replyType.Kind() != reflect.Ptr { // the server only replies through a pointer
+		return fmt.Errorf("can't call %s, its reply %s is not a pointer", serviceMethod, m.ReplyType)
+	}
+	argv := reflect.New(argType)
+	if args != "" {
+		if err := json.Unmarshal([]byte(args), argv.Interface()); err != nil {
+			return fmt.Errorf("can't decode args as %s: %w", m.ArgType, err)
+		}
+	}
+
+	var failed int
+	var total, max time.Duration
+	for i := 0; i < n; i++ {
+		reply := reflect.New(replyType.Elem())
+		start := time.Now()
+		err := c.invoke(serviceMethod, argv.Elem().Interface(), reply.Interface())
+		d := time.Since(start)
+		total += d
+		if d > max {
+			max = d
+		}
+		if err != nil && n == 1 {
+			return err
+		}
+		if err != nil {
+			failed++
+			_, _ = fmt.Fprintf(c.stderr, "geerpc: call %d: %s: %v\n", i+1, geerpc.CodeOf(err), err)
+			continue
+		}
+		b, err := json.Marshal(reply.Interface())
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(c.stdout, string(b))
+	}
+	if n > 1 {
+		_, _ = fmt.Fprintf(c.stderr, "%d calls, %d errors, avg %s, max %s\n", n, failed, total/time.Duration(n), max)
+	}
+	if failed > 0 {
+		return errors.New("some calls failed")
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"geerpc"
+	"net"
+	"strings"
+	"testing"
+)
+
+type Args struct {
+	Num1, Num2 int
+}
+
+type Pair struct {
+	Sum  int
+	Tags []string
+}
+
+type Calc int
+
+func (c Calc) Add(ctx context.Context, args Args, reply *Pair) error {
+	reply.Sum = args.Num1 + args.Num2
+	reply.Tags = []string{geerpc.MetadataFromContext(ctx)["user"]}
+	return nil
+}
+
+// Split takes its reply by value, which the server can describe but not call
+func (c Calc) Split(args Args, reply map[string]int) error {
+	reply["Num1"], reply["Num2"] = args.Num1, args.Num2
+	return nil
+}
+
+func startServer(t *testing.T) string {
+	s := geerpc.NewServer()
+	var calc Calc
+	_ = s.Register(&calc)
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal("network error:", err)
+	}
+	go s.Accept(l)
+	t.Cleanup(func() { _ = l.Close() })
+	return "tcp@" + l.Addr().String()
+}
+
+func TestRun(t *testing.T) {
+	addr := startServer(t)
+	for _, tc := range []struct {
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{[]string{"-addr", addr, "list"}, 0, "Calc\nHealth\n_reflection\n", ""},
+		{[]string{"-addr", addr, "describe", "Calc"}, 0,
+			"Calc.Add(main.Args) *main.Pair\nCalc.Split(main.Args) map[string]int\ntype main.Args struct { Num1 int; Num2 int }\ntype main.Pair struct { Sum int; Tags []string }\n", ""},
+		{[]string{"-addr", addr, "-md", "user=alice", "call", "Calc.Add", `{"Num1": 1, "Num2": 2}`}, 0, `{"Sum":3,"Tags":["alice"]}` + "\n", ""},
+		{[]string{"-addr", addr, "-codec", "json", "-n", "2", "call", "Calc.Add", `{"Num1": 2}`}, 0,
+			`{"Sum":2,"Tags":[""]}` + "\n" + `{"Sum":2,"Tags":[""]}` + "\n", "2 calls, 0 errors"},
+		{[]string{"-addr", addr, "call", "Calc.Split", `{"Num1": 1}`}, 1, "", "reply map[string]int is not a pointer"},
+		{[]string{"-addr", addr, "call", "Calc.Missing"}, 1, "", "can't find method Calc.Missing"},
+		{[]string{"-addr", addr, "call", "Calc.Add", `{"Num1": "x"}`}, 1, "", "can't decode args"},
+		{[]string{"-addr", addr}, 2, "", "usage:"},
+		{[]string{"list"}, 2, "", "usage:"},
+	} {
+		var stdout, stderr bytes.Buffer
+		code := run(tc.args, &stdout, &stderr)
+		if code != tc.code || stdout.String() != tc.stdout || !strings.Contains(stderr.String(), tc.stderr) {
+			t.Errorf("%v: expect %d %q %q, got %d %q %q", tc.args, tc.code, tc.stdout, tc.stderr, code, stdout.String(), stderr.String())
+		}
+	}
+}
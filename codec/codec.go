@@ -7,6 +7,8 @@ type Header struct {
 	ServiceMethod string // format "Service.Method"
 	Seq           uint64 // sequence number chosen by client
 	Error         string
+	Code          int               // error code set by server, 0 means ok
+	Metadata      map[string]string // request scoped key-value pairs, e.g. caller identity
 }
 
 // Codec encodes/decodes a message header and body
@@ -23,7 +25,7 @@ type Type string
 
 const (
 	GobType  Type = "application/gob"   // a codec type
-	JsonType Type = "application/json"  // not implemented
+	JsonType Type = "application/json"  // a codec type
 	PbType   Type = "application/proto" // not implemented
 
 )
@@ -33,4 +35,5 @@ var NewCodecFuncMap map[Type]NewCodecFunc
 func init() {
 	NewCodecFuncMap = make(map[Type]NewCodecFunc)
 	NewCodecFuncMap[GobType] = NewGobCodec
+	NewCodecFuncMap[JsonType] = NewJsonCodec
 }
@@ -0,0 +1,77 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+// buffer is an in-memory connection, what is written can be read back
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) Close() error {
+	return nil
+}
+
+type payload struct {
+	Name   string
+	Values []float64
+}
+
+func TestCodecs(t *testing.T) {
+	for codecType, f := range NewCodecFuncMap {
+		conn := new(buffer)
+		c := f(conn)
+		h := &Header{ServiceMethod: "Foo.Sum", Seq: 7, Metadata: map[string]string{"k": "v"}}
+		if err := c.Write(h, payload{Name: "a", Values: []float64{1, 2}}); err != nil {
+			t.Fatalf("%s: write error: %v", codecType, err)
+		}
+		_ = c.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 8}, payload{Name: "discarded"})
+		_ = c.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 9}, payload{Name: "b"})
+
+		var got Header
+		var body payload
+		if err := c.ReadHeader(&got); err != nil || got.Seq != 7 || got.Metadata["k"] != "v" {
+			t.Fatalf("%s: expect the header back, got %+v, %v", codecType, got, err)
+		}
+		if err := c.ReadBody(&body); err != nil || body.Name != "a" || len(body.Values) != 2 {
+			t.Fatalf("%s: expect the body back, got %+v, %v", codecType, body, err)
+		}
+		_ = c.ReadHeader(&got)
+		if err := c.ReadBody(nil); err != nil {
+			t.Fatalf("%s: expect ReadBody(nil) to discard the body, got %v", codecType, err)
+		}
+		got, body = Header{}, payload{}
+		_ = c.ReadHeader(&got)
+		_ = c.ReadBody(&body)
+		if got.Seq != 9 || body.Name != "b" {
+			t.Fatalf("%s: expect the message after the discarded one, got %+v %+v", codecType, got, body)
+		}
+	}
+}
+
+func BenchmarkCodecs(b *testing.B) {
+	for codecType, f := range NewCodecFuncMap {
+		b.Run(string(codecType), func(b *testing.B) {
+			conn := new(buffer)
+			c := f(conn)
+			h := &Header{ServiceMethod: "Foo.Sum"}
+			body := payload{Name: "payload", Values: make([]float64, 64)}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				h.Seq = uint64(i)
+				if err := c.Write(h, body); err != nil {
+					b.Fatal("write error:", err)
+				}
+				var got payload
+				if err := c.ReadHeader(h); err != nil {
+					b.Fatal("read error:", err)
+				}
+				if err := c.ReadBody(&got); err != nil {
+					b.Fatal("read error:", err)
+				}
+			}
+		})
+	}
+}
@@ -3,8 +3,8 @@ package codec
 import (
 	"bufio"
 	"encoding/gob"
+	"fmt"
 	"io"
-	"log"
 )
 
 type GobCodec struct {
@@ -30,12 +30,10 @@ func (c *GobCodec) Write(h *Header, body interface{}) (err error) {
 		}
 	}()
 	if err = c.enc.Encode(h); err != nil {
-		log.Println("rpc codec: gob error encoding header:", err)
-		return err
+		return fmt.Errorf("rpc codec: gob error encoding header: %w", err)
 	}
 	if err = c.enc.Encode(body); err != nil {
-		log.Println("rpc codec: gob error encoding body:", err)
-		return err
+		return fmt.Errorf("rpc codec: gob error encoding body: %w", err)
 	}
 	return nil
 }
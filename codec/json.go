@@ -3,8 +3,8 @@ package codec
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"io"
-	"log"
 )
 
 type JsonCodec struct {
@@ -19,6 +19,10 @@ func (c *JsonCodec) ReadHeader(h *Header) error {
 }
 
 func (c *JsonCodec) ReadBody(body interface{}) error {
+	if body == nil { // discard the body
+		var raw json.RawMessage
+		return c.dec.Decode(&raw)
+	}
 	return c.dec.Decode(body)
 }
 
@@ -30,12 +34,10 @@ func (c *JsonCodec) Write(h *Header, body interface{}) (err error) {
 		}
 	}()
 	if err = c.enc.Encode(h); err != nil {
-		log.Println("rpc codec: json error encoding header:", err)
-		return err
+		return fmt.Errorf("rpc codec: json error encoding header: %w", err)
 	}
 	if err = c.enc.Encode(body); err != nil {
-		log.Println("rpc codec: json error encoding body:", err)
-		return err
+		return fmt.Errorf("rpc codec: json error encoding body: %w", err)
 	}
 	return nil
 }
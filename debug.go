@@ -1,9 +1,17 @@
 package geerpc
 
 import (
+	"encoding/json"
 	"fmt"
+	"geerpc/codec"
 	"html/template"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const debugText = `
@@ -13,20 +21,41 @@ const debugText = `
 </head>
 <body>
 <h1>GeeRPC debug</h1>
-{{range .}}
+{{range .Services}}
 <hr>
 Service {{.Name}}
 <hr>
 <table>
-<th align=center>Method</th><th align=center>Calls</th>
-{{range $name, $mtype := .Method}}
+<th align=center>Method</th><th align=center>Calls</th><th align=center>Rejected</th><th align=center>Errors</th>
+<th align=center>p50</th><th align=center>p95</th><th align=center>p99</th><th align=center>Last error</th>
+{{range .Methods}}
 	<tr>
-	<td align=left font=fixed>{{$name}}({{$mtype.ArgType}}, {{$mtype.ReplyType}}) error</td>
-	<td align=center>{{$mtype.NumCalls}}</td>
+	<td align=left font=fixed>{{.Signature}}</td>
+	<td align=center>{{.Calls}}</td>
+	<td align=center>{{.Rejected}}</td>
+	<td align=center>{{range $code, $n := .Errors}}{{$code}}: {{$n}} {{end}}</td>
+	<td align=center>{{.P50}}</td>
+	<td align=center>{{.P95}}</td>
+	<td align=center>{{.P99}}</td>
+	<td align=left>{{.LastError}}</td>
 	</tr>
 {{end}}
 </table>
 {{end}}
+<hr>
+Connections
+<hr>
+<table>
+<th align=center>Remote</th><th align=center>Codec</th><th align=center>Since</th><th align=center>In-flight requests</th>
+{{range .Connections}}
+	<tr>
+	<td align=left>{{.Remote}}</td>
+	<td align=center>{{.Codec}}</td>
+	<td align=center>{{.Since.Format "2006-01-02 15:04:05"}}</td>
+	<td align=left>{{range .Requests}}#{{.Seq}} {{.Method}} ({{.Age}})<br>{{end}}</td>
+	</tr>
+{{end}}
+</table>
 </body>
 </html>`
 
@@ -36,22 +65,144 @@ type debugHTTP struct {
 	*Server
 }
 
+// connState is what the debug page shows about a connection being served
+type connState struct {
+	remote   string
+	codec    codec.Type
+	since    time.Time
+	inFlight sync.Map // seq -> *inFlightRequest
+}
+
+type inFlightRequest struct {
+	method string
+	start  time.Time
+}
+
+// debugDuration is rendered as a duration on the HTML page, and as seconds in JSON
+type debugDuration time.Duration
+
+func (d debugDuration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d debugDuration) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatFloat(time.Duration(d).Seconds(), 'g', -1, 64)), nil
+}
+
+func (d *debugDuration) UnmarshalJSON(b []byte) error {
+	seconds, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return err
+	}
+	*d = debugDuration(seconds * float64(time.Second))
+	return nil
+}
+
+type debugMethod struct {
+	Name          string            `json:"name"`
+	Signature     string            `json:"signature"`
+	Calls         uint64            `json:"calls"`
+	Rejected      uint64            `json:"rejected"`
+	Errors        map[string]uint64 `json:"errors,omitempty"` // by code
+	P50           debugDuration     `json:"p50_seconds"`
+	P95           debugDuration     `json:"p95_seconds"`
+	P99           debugDuration     `json:"p99_seconds"`
+	LastError     string            `json:"last_error,omitempty"`
+	LastErrorTime *time.Time        `json:"last_error_time,omitempty"`
+}
+
 type debugService struct {
-	Name   string
-	Method map[string]*methodType
+	Name    string        `json:"name"`
+	Methods []debugMethod `json:"methods"`
 }
 
-func (server debugHTTP) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	var services []debugService
+type debugRequest struct {
+	Seq    uint64        `json:"seq"`
+	Method string        `json:"method"`
+	Age    debugDuration `json:"age_seconds"`
+}
+
+type debugConn struct {
+	Remote   string         `json:"remote"`
+	Codec    codec.Type     `json:"codec"`
+	Since    time.Time      `json:"since"`
+	Requests []debugRequest `json:"in_flight"`
+}
+
+type debugInfo struct {
+	Services    []debugService `json:"services"`
+	Connections []debugConn    `json:"connections"`
+}
+
+func newDebugMethod(name string, m *methodType) debugMethod {
+	args := m.ArgType.String() + ", " + m.ReplyType.String()
+	if m.withContext {
+		args = "context.Context, " + args
+	}
+	dm := debugMethod{
+		Name:      name,
+		Signature: fmt.Sprintf("%s(%s) error", name, args),
+		Calls:     m.NumCalls(),
+		Rejected:  m.NumRejected(),
+	}
+	for code := range m.stats.errors {
+		if n := atomic.LoadUint64(&m.stats.errors[code]); n > 0 {
+			if dm.Errors == nil {
+				dm.Errors = make(map[string]uint64)
+			}
+			dm.Errors[Code(code).String()] = n
+		}
+	}
+	ps := m.stats.window.percentiles(50, 95, 99)
+	dm.P50, dm.P95, dm.P99 = debugDuration(ps[0]), debugDuration(ps[1]), debugDuration(ps[2])
+	if msg, at := m.stats.lastError(); msg != "" {
+		dm.LastError, dm.LastErrorTime = msg, &at
+	}
+	return dm
+}
+
+func (server debugHTTP) info() debugInfo {
+	var info debugInfo
 	server.serviceMap.Range(func(namei, svci interface{}) bool {
 		svc := svci.(*service)
-		services = append(services, debugService{
-			Name:   namei.(string),
-			Method: svc.method,
+		ds := debugService{Name: namei.(string)}
+		for name, m := range svc.method {
+			ds.Methods = append(ds.Methods, newDebugMethod(name, m))
+		}
+		sort.Slice(ds.Methods, func(i, j int) bool { return ds.Methods[i].Name < ds.Methods[j].Name })
+		info.Services = append(info.Services, ds)
+		return true
+	})
+	sort.Slice(info.Services, func(i, j int) bool { return info.Services[i].Name < info.Services[j].Name })
+
+	now := time.Now()
+	server.conns.Range(func(csi, _ interface{}) bool {
+		cs := csi.(*connState)
+		dc := debugConn{Remote: cs.remote, Codec: cs.codec, Since: cs.since, Requests: []debugRequest{}}
+		cs.inFlight.Range(func(seqi, ri interface{}) bool {
+			r := ri.(*inFlightRequest)
+			dc.Requests = append(dc.Requests, debugRequest{Seq: seqi.(uint64), Method: r.method, Age: debugDuration(now.Sub(r.start))})
+			return true
 		})
+		sort.Slice(dc.Requests, func(i, j int) bool { return dc.Requests[i].Seq < dc.Requests[j].Seq })
+		info.Connections = append(info.Connections, dc)
 		return true
 	})
-	err := debug.Execute(w, services)
+	sort.Slice(info.Connections, func(i, j int) bool { return info.Connections[i].Since.Before(info.Connections[j].Since) })
+	return info
+}
+
+// ServeHTTP renders the debug page as HTML, or as JSON for ?format=json or an Accept header asking for JSON
+func (server debugHTTP) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	info := server.info()
+	if req.URL.Query().Get("format") == "json" || strings.Contains(req.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(info); err != nil {
+			server.logger.Error("rpc server: error encoding debug info", "err", err)
+		}
+		return
+	}
+	err := debug.Execute(w, info)
 	if err != nil {
 		_, _ = fmt.Fprintln(w, "rpc server: error executing template:", err.Error())
 	}
@@ -0,0 +1,70 @@
+package geerpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugHTTP_JSON(t *testing.T) {
+	s := NewServer()
+	addr := startTestServer(t, s, new(Slow))
+
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	var reply int
+	_ = client.Call(context.Background(), "Slow.Sleep", 0, &reply)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_ = client.Call(ctx, "Slow.Wait", 0, &reply) // fails with DeadlineExceeded on the server
+	call := client.Go("Slow.Sleep", 300, &reply, make(chan *Call, 1))
+
+	var info debugInfo
+	for i := 0; i < 100; i++ { // wait until only the pending call is in flight
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/debug/geerpc", nil)
+		req.Header.Set("Accept", "application/json")
+		debugHTTP{s}.ServeHTTP(rec, req)
+		_assert(strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json"), "expect a JSON response")
+		info = debugInfo{}
+		_ = json.NewDecoder(rec.Body).Decode(&info)
+		// Slow.Wait may still be in flight after the client gave up
+		if len(info.Connections) == 1 && len(info.Connections[0].Requests) == 1 && info.Connections[0].Requests[0].Method == "Slow.Sleep" {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	var svc *debugService
+	for i := range info.Services {
+		if info.Services[i].Name == "Slow" {
+			svc = &info.Services[i]
+		}
+	}
+	_assert(svc != nil, "expect service Slow, got %+v", info.Services)
+	methods := make(map[string]debugMethod)
+	for _, m := range svc.Methods {
+		methods[m.Name] = m
+	}
+	wait := methods["Wait"]
+	_assert(wait.Calls == 1 && wait.Errors["DeadlineExceeded"] == 1, "expect one DeadlineExceeded error, got %+v", wait)
+	_assert(wait.LastError != "" && wait.LastErrorTime != nil, "expect the last error, got %+v", wait)
+	_assert(strings.HasPrefix(wait.Signature, "Wait(context.Context, "), "expect context in signature, got %q", wait.Signature)
+	_assert(methods["Sleep"].P99 >= methods["Sleep"].P50, "expect ordered percentiles, got %+v", methods["Sleep"])
+
+	_assert(len(info.Connections) == 1, "expect one connection, got %+v", info.Connections)
+	conn := info.Connections[0]
+	_assert(conn.Remote != "", "expect remote address, got %+v", conn)
+	_assert(conn.Codec == DefaultOption.CodecType, "expect codec %s, got %s", DefaultOption.CodecType, conn.Codec)
+	_assert(len(conn.Requests) == 1 && conn.Requests[0].Method == "Slow.Sleep" && conn.Requests[0].Age > 0,
+		"expect the pending call in flight, got %+v", conn.Requests)
+	<-call.Done
+
+	rec := httptest.NewRecorder()
+	debugHTTP{s}.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/geerpc", nil))
+	_assert(strings.Contains(rec.Body.String(), "DeadlineExceeded: 1"), "expect error counts on the HTML page")
+}
@@ -0,0 +1,69 @@
+package geerpc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Code classifies an error, it is carried to the client in the response header
+type Code int
+
+const (
+	CodeOK Code = iota
+	CodeUnknown
+	CodeInvalidArgument
+	CodeNotFound
+	CodeDeadlineExceeded
+	CodeResourceExhausted
+	CodeUnauthenticated
+	CodePermissionDenied
+	CodeUnavailable
+	CodeInternal
+)
+
+var codeNames = [...]string{
+	CodeOK:                "OK",
+	CodeUnknown:           "Unknown",
+	CodeInvalidArgument:   "InvalidArgument",
+	CodeNotFound:          "NotFound",
+	CodeDeadlineExceeded:  "DeadlineExceeded",
+	CodeResourceExhausted: "ResourceExhausted",
+	CodeUnauthenticated:   "Unauthenticated",
+	CodePermissionDenied:  "PermissionDenied",
+	CodeUnavailable:       "Unavailable",
+	CodeInternal:          "Internal",
+}
+
+func (c Code) String() string {
+	if c >= 0 && int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+	return fmt.Sprintf("Code(%d)", int(c))
+}
+
+// Error is an error with a Code. Service methods may return it to choose the code the client sees.
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf formats an error message with the given code
+func Errorf(code Code, format string, a ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+// CodeOf returns the code of err, CodeOK for nil and CodeUnknown for errors without a code
+func CodeOf(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnknown
+}
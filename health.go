@@ -0,0 +1,94 @@
+package geerpc
+
+import (
+	"context"
+	"sync"
+)
+
+// HealthService is the name of the built-in health-checking service, call "Health.Check" with a HealthCheckRequest.
+// There is no Health.Watch, as calls can't stream, clients poll Health.Check instead.
+const HealthService = "Health"
+
+// HealthStatus is the serving status of a server or one of its services
+type HealthStatus int
+
+const (
+	HealthUnknown HealthStatus = iota
+	HealthServing
+	HealthNotServing
+)
+
+func (st HealthStatus) String() string {
+	switch st {
+	case HealthServing:
+		return "SERVING"
+	case HealthNotServing:
+		return "NOT_SERVING"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+type HealthCheckRequest struct {
+	Service string // empty means the whole server
+}
+
+type HealthCheckResponse struct {
+	Status HealthStatus
+}
+
+// healthService is registered on every server as HealthService
+type healthService struct {
+	mu     sync.RWMutex
+	status map[string]HealthStatus // set by SetServingStatus, "" is the whole server
+	server *Server
+}
+
+// Check replies the status of the service, or of the server if no service is named.
+// A service reports NOT_SERVING while the server does, and SERVING once registered unless set otherwise.
+func (h *healthService) Check(req HealthCheckRequest, resp *HealthCheckResponse) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if st, ok := h.status[""]; ok && st == HealthNotServing {
+		resp.Status = HealthNotServing
+		return nil
+	}
+	if st, ok := h.status[req.Service]; ok {
+		resp.Status = st
+		return nil
+	}
+	if req.Service == "" {
+		resp.Status = HealthServing
+		return nil
+	}
+	if _, ok := h.server.serviceMap.Load(req.Service); !ok {
+		return Errorf(CodeNotFound, "rpc server: can't find service %s", req.Service)
+	}
+	resp.Status = HealthServing
+	return nil
+}
+
+// SetServingStatus sets the status reported by Health.Check for the service, or for the whole server if service is empty.
+// E.g. set the server NOT_SERVING before shutting down, so that registries and XClients stop sending it calls.
+func (s *Server) SetServingStatus(service string, status HealthStatus) {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+	s.health.status[service] = status
+}
+
+// registerHealth registers the health service of s
+func (s *Server) registerHealth() {
+	s.health = &healthService{status: make(map[string]HealthStatus), server: s}
+	svc := newService(s.health, s.logger)
+	svc.name = HealthService
+	_ = s.register(svc)
+}
+
+// CheckHealth calls Health.Check on the server for the service, or for the whole server if service is empty
+func (c *Client) CheckHealth(ctx context.Context, service string) (HealthStatus, error) {
+	var resp HealthCheckResponse
+	if err := c.Call(ctx, HealthService+".Check", HealthCheckRequest{Service: service}, &resp); err != nil {
+		return HealthUnknown, err
+	}
+	return resp.Status, nil
+}
@@ -0,0 +1,34 @@
+package geerpc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestServer_Health(t *testing.T) {
+	s := NewServer()
+	addr := startTestServer(t, s, new(Foo))
+
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	ctx := context.Background()
+
+	status, err := client.CheckHealth(ctx, "")
+	_assert(err == nil && status == HealthServing, "expect server SERVING, got %s, %v", status, err)
+	status, err = client.CheckHealth(ctx, "Foo")
+	_assert(err == nil && status == HealthServing, "expect registered service SERVING, got %s, %v", status, err)
+	_, err = client.CheckHealth(ctx, "Missing")
+	_assert(CodeOf(err) == CodeNotFound, "expect NotFound for an unknown service, got %v", err)
+
+	s.SetServingStatus("Foo", HealthNotServing)
+	status, _ = client.CheckHealth(ctx, "Foo")
+	_assert(status == HealthNotServing, "expect service NOT_SERVING, got %s", status)
+	status, _ = client.CheckHealth(ctx, "")
+	_assert(status == HealthServing, "expect server still SERVING, got %s", status)
+
+	s.SetServingStatus("Foo", HealthServing)
+	s.SetServingStatus("", HealthNotServing)
+	status, _ = client.CheckHealth(ctx, "Foo")
+	_assert(status == HealthNotServing, "expect services NOT_SERVING while the server is, got %s", status)
+}
@@ -0,0 +1,171 @@
+package geerpc
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	hedgeMinSamples = 20 // latencies observed before hedging after the p95
+	hedgeMaxTokens  = 10 // hedges a HedgePolicy can save up for a burst
+)
+
+// HedgePolicy sends copies of a call which hasn't been answered after a delay, the first reply wins and
+// the other copies are cancelled. It cuts the tail latency at the cost of extra load, which Budget caps.
+// The server may handle every copy, only hedge idempotent methods.
+type HedgePolicy struct {
+	// Delay is the wait before sending every copy, 0 means the p95 latency observed for the method,
+	// the method isn't hedged until enough calls have been observed then
+	Delay     time.Duration
+	MaxHedges int     // copies sent besides the call, 0 means 1
+	Budget    float64 // copies allowed per call on average, 0 means 0.1, i.e. 10% extra load
+	// Methods holds the "Service.Method"s, or whole "Service"s, which are hedged
+	Methods map[string]bool
+
+	mu        sync.Mutex // protect following
+	tokens    float64    // hedges allowed now, every call adds Budget
+	latencies sync.Map   // serviceMethod -> *latencyWindow
+}
+
+func (p *HedgePolicy) hedged(serviceMethod string) bool {
+	if p.Methods[serviceMethod] {
+		return true
+	}
+	for i := len(serviceMethod) - 1; i >= 0; i-- {
+		if serviceMethod[i] == '.' {
+			return p.Methods[serviceMethod[:i]]
+		}
+	}
+	return false
+}
+
+// delay returns the wait before hedging a call of serviceMethod, false if it can't be hedged yet
+func (p *HedgePolicy) delay(serviceMethod string) (time.Duration, bool) {
+	if p.Delay > 0 {
+		return p.Delay, true
+	}
+	w, ok := p.latencies.Load(serviceMethod)
+	if !ok {
+		return 0, false
+	}
+	window := w.(*latencyWindow)
+	window.mu.Lock()
+	n := window.n
+	window.mu.Unlock()
+	if n < hedgeMinSamples {
+		return 0, false
+	}
+	return window.percentiles(95)[0], true
+}
+
+func (p *HedgePolicy) observe(serviceMethod string, d time.Duration) {
+	w, _ := p.latencies.LoadOrStore(serviceMethod, new(latencyWindow))
+	w.(*latencyWindow).add(d)
+}
+
+// deposit adds the budget of a call
+func (p *HedgePolicy) deposit() {
+	budget := p.Budget
+	if budget <= 0 {
+		budget = 0.1
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tokens += budget; p.tokens > hedgeMaxTokens {
+		p.tokens = hedgeMaxTokens
+	}
+}
+
+// withdraw takes the budget of a hedge, it returns false if there isn't enough left
+func (p *HedgePolicy) withdraw() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tokens < 1 {
+		return false
+	}
+	p.tokens--
+	return true
+}
+
+// Do makes the call, and makes copies of it while it isn't answered within the delay, as far as MaxHedges and
+// the budget allow. Every copy gets its own reply of the type of reply and a ctx cancelled once one succeeds,
+// the reply of the first success is copied to reply. Do fails with the last error if every copy fails.
+// A nil policy, or one not hedging serviceMethod, makes the call once with ctx and reply.
+func (p *HedgePolicy) Do(ctx context.Context, serviceMethod string, reply interface{},
+	call func(ctx context.Context, reply interface{}) error) error {
+	if p == nil || !p.hedged(serviceMethod) {
+		return call(ctx, reply)
+	}
+	p.deposit()
+	delay, ok := p.delay(serviceMethod)
+	if !ok {
+		start := time.Now()
+		err := call(ctx, reply)
+		if err == nil {
+			p.observe(serviceMethod, time.Since(start))
+		}
+		return err
+	}
+	maxHedges := p.MaxHedges
+	if maxHedges <= 0 {
+		maxHedges = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // cancels the copies still waiting
+	type result struct {
+		reply interface{}
+		err   error
+		start time.Time
+		hedge bool
+	}
+	results := make(chan result, 1+maxHedges)
+	send := func(hedge bool) {
+		r := result{start: time.Now(), hedge: hedge}
+		if reply != nil {
+			r.reply = reflect.New(reflect.TypeOf(reply).Elem()).Interface()
+		}
+		go func() {
+			r.err = call(ctx, r.reply)
+			results <- r
+		}()
+	}
+	send(false)
+	pending, hedges := 1, 0
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var err error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if !p.withdraw() {
+				atomic.AddUint64(&clientHedgesThrottled, 1)
+				continue
+			}
+			atomic.AddUint64(&clientHedges, 1)
+			send(true)
+			pending++
+			if hedges++; hedges < maxHedges {
+				timer.Reset(delay)
+			}
+		case r := <-results:
+			pending--
+			if r.err != nil {
+				err = r.err
+				continue
+			}
+			if reply != nil {
+				reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(r.reply).Elem())
+			}
+			p.observe(serviceMethod, time.Since(r.start))
+			if r.hedge {
+				atomic.AddUint64(&clientHedgeWins, 1)
+			}
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowFirst returns a call which takes d the first time and replies at once afterwards
+func slowFirst(d time.Duration, calls *int32) func(ctx context.Context, reply interface{}) error {
+	return func(ctx context.Context, reply interface{}) error {
+		n := atomic.AddInt32(calls, 1)
+		if n == 1 {
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		*reply.(*int32) = n
+		return nil
+	}
+}
+
+func TestHedgePolicy_Do(t *testing.T) {
+	p := &HedgePolicy{Delay: time.Millisecond * 10, Budget: 1, Methods: map[string]bool{"Foo": true}}
+	hedges, wins := atomic.LoadUint64(&clientHedges), atomic.LoadUint64(&clientHedgeWins)
+	var calls int32
+	var reply int32
+	start := time.Now()
+	err := p.Do(context.Background(), "Foo.Sum", &reply, slowFirst(time.Second, &calls))
+	_assert(err == nil && reply == 2, "expect the hedge to win, got %d %v", reply, err)
+	_assert(time.Since(start) < time.Millisecond*500, "expect the hedge to cut the latency")
+	_assert(atomic.LoadUint64(&clientHedges) == hedges+1 && atomic.LoadUint64(&clientHedgeWins) == wins+1,
+		"expect the hedge to be counted")
+
+	calls = 0
+	err = p.Do(context.Background(), "Bar.Sum", &reply, slowFirst(time.Millisecond*30, &calls))
+	_assert(err == nil && reply == 1 && calls == 1, "expect methods not in Methods to be called once")
+
+	failed := errors.New("failed")
+	calls = 0
+	err = p.Do(context.Background(), "Foo.Sum", &reply, func(ctx context.Context, reply interface{}) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			time.Sleep(time.Millisecond * 30)
+		}
+		return failed
+	})
+	_assert(errors.Is(err, failed) && atomic.LoadInt32(&calls) == 2, "expect the error once every copy failed, got %v", err)
+}
+
+func TestHedgePolicy_budget(t *testing.T) {
+	p := &HedgePolicy{Delay: time.Millisecond, Budget: 0.5, Methods: map[string]bool{"Foo.Sum": true}}
+	throttled := atomic.LoadUint64(&clientHedgesThrottled)
+	hedged := 0
+	for i := 0; i < 10; i++ {
+		var calls, reply int32
+		_ = p.Do(context.Background(), "Foo.Sum", &reply, slowFirst(time.Millisecond*20, &calls))
+		if reply == 2 {
+			hedged++
+		}
+	}
+	_assert(hedged == 5, "expect half of the calls to be hedged, got %d", hedged)
+	_assert(atomic.LoadUint64(&clientHedgesThrottled) == throttled+5, "expect the throttled hedges to be counted")
+}
+
+func TestHedgePolicy_p95(t *testing.T) {
+	p := &HedgePolicy{Budget: 1, Methods: map[string]bool{"Foo.Sum": true}}
+	var reply int32
+	for i := 0; i < hedgeMinSamples; i++ {
+		var calls int32
+		_ = p.Do(context.Background(), "Foo.Sum", &reply, slowFirst(time.Millisecond*5, &calls))
+		_assert(reply == 1, "expect no hedging before enough latencies are observed")
+	}
+	d, ok := p.delay("Foo.Sum")
+	_assert(ok && d >= time.Millisecond*5 && d < time.Millisecond*100, "expect the p95 delay, got %s", d)
+	var calls int32
+	_ = p.Do(context.Background(), "Foo.Sum", &reply, slowFirst(time.Second, &calls))
+	_assert(reply == 2, "expect a call slower than the p95 to be hedged")
+}
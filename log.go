@@ -0,0 +1,26 @@
+package geerpc
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardHandler drops every record
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// DiscardLogger drops every record. It is the default logger of servers and clients,
+// so the library stays silent unless a logger is configured with WithLogger or Option.Logger.
+var DiscardLogger = slog.New(discardHandler{})
+
+// WithLogger sets the logger of the server. Connection and request errors are logged at
+// error and warn level, every request at debug level with its seq, method, remote address and duration.
+func WithLogger(logger *slog.Logger) ServerOption {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
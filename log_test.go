@@ -0,0 +1,65 @@
+package geerpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes of a slog handler
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) records() []map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var r map[string]interface{}
+		if json.Unmarshal([]byte(line), &r) == nil {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+func TestServer_Logger(t *testing.T) {
+	var out syncBuffer
+	logger := slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	addr := startTestServer(t, NewServer(WithLogger(logger)), new(Foo))
+
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	var reply int
+	_ = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_ = client.Close()
+
+	var found bool
+	for _, r := range out.records() {
+		if r["msg"] != "rpc server: handle request" {
+			continue
+		}
+		found = r["level"] == "DEBUG" && r["method"] == "Foo.Sum" && r["seq"] == float64(1) &&
+			r["remote"] != nil && r["duration"] != nil
+	}
+	_assert(found, "expect a debug record with seq, method, remote and duration")
+}
+
+func TestServer_SilentByDefault(t *testing.T) {
+	s := NewServer()
+	_assert(s.logger == DiscardLogger, "expect servers to discard logs by default")
+	_assert(!s.logger.Enabled(context.Background(), slog.LevelError), "expect discard logger to be disabled")
+	_assert(loggerOf(DefaultOption) == DiscardLogger, "expect clients to discard logs by default")
+}
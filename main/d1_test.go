@@ -11,7 +11,15 @@ import (
 	"time"
 )
 
+type Echo int
+
+func (e Echo) Hi(args string, reply *string) error {
+	*reply = args
+	return nil
+}
+
 func startServer(addr chan string) {
+	_ = geerpc.Register(new(Echo)) // d1 and d2 share the default server
 	l, err := net.Listen("tcp", ":0")
 	if err != nil {
 		log.Fatal("network error:", err)
@@ -33,7 +41,7 @@ func TestServer(t *testing.T) {
 	cc := codec.NewGobCodec(conn)
 	for i := 0; i < 5; i++ {
 		h := &codec.Header{
-			ServiceMethod: "Foo.Sum",
+			ServiceMethod: "Echo.Hi",
 			Seq:           uint64(i),
 		}
 		_ = cc.Write(h, fmt.Sprintf("geerpc req %d", h.Seq))
@@ -26,8 +26,8 @@ func TestClient(t *testing.T) {
 			defer wg.Done()
 			args := fmt.Sprintf("geerpc req %d", i)
 			var reply string
-			if err := client.Call(context.Background(), "Foo.Sum", args, &reply); err != nil {
-				log.Fatal("call Foo.Sum error:", err)
+			if err := client.Call(context.Background(), "Echo.Hi", args, &reply); err != nil {
+				log.Fatal("call Echo.Hi error:", err)
 			}
 			log.Println("reply:", reply)
 		}(i)
@@ -14,7 +14,7 @@ import (
 )
 
 func startRegistry(wg *sync.WaitGroup) {
-	l, _ := net.Listen("tcp", ":9999")
+	l, _ := net.Listen("tcp", ":9998") // :9999 is taken by the HTTP server in d5
 	registry.HandleHTTP()
 	wg.Done()
 	_ = http.Serve(l, nil)
@@ -55,7 +55,8 @@ func broadcastV2(registry string) {
 		go func(i int) {
 			defer wg.Done()
 			foo(xc, context.Background(), "broadcast", "Foo.Sum", &Args{Num1: i, Num2: i * i})
-			ctx, _ := context.WithTimeout(context.Background(), time.Second*2)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+			defer cancel()
 			foo(xc, ctx, "broadcast", "Foo.Sleep", &Args{Num1: i, Num2: i * i})
 		}(i)
 	}
@@ -64,7 +65,7 @@ func broadcastV2(registry string) {
 
 func TestRegistry(t *testing.T) {
 	log.SetFlags(0)
-	registryAddr := "http://localhost:9999/_geerpc_/registry"
+	registryAddr := "http://localhost:9998/_geerpc_/registry"
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go startRegistry(&wg)
@@ -0,0 +1,108 @@
+package main_test
+
+import (
+	"context"
+	"geerpc"
+	"geerpc/registry"
+	"geerpc/xclient"
+	"net"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Counter counts the calls a server receives
+type Counter struct {
+	n int64
+}
+
+func (c *Counter) Hit(_ int, reply *int64) error {
+	*reply = atomic.AddInt64(&c.n, 1)
+	return nil
+}
+
+// startTestServer serves rcvrs on a random port until the test ends, it returns the server and its address
+func startTestServer(t *testing.T, rcvrs ...interface{}) (*geerpc.Server, string) {
+	server := geerpc.NewServer()
+	for _, rcvr := range rcvrs {
+		if err := server.Register(rcvr); err != nil {
+			t.Fatal("register error:", err)
+		}
+	}
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal("network error:", err)
+	}
+	go server.Accept(l)
+	t.Cleanup(func() { _ = l.Close() })
+	return server, "tcp@" + l.Addr().String()
+}
+
+func TestXClient_HealthCheck(t *testing.T) {
+	c1, c2 := new(Counter), new(Counter)
+	s1, addr1 := startTestServer(t, new(Foo), c1)
+	_, addr2 := startTestServer(t, new(Foo), c2)
+	s1.SetServingStatus("", geerpc.HealthNotServing)
+
+	d := xclient.NewMultiServerDiscovery([]string{addr1, addr2})
+	xc := xclient.NewXClient(d, xclient.RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.EnableHealthCheck(time.Millisecond * 50)
+
+	for i := 0; i < 10; i++ {
+		var n int64
+		if err := xc.Call(context.Background(), "Counter.Hit", 0, &n); err != nil {
+			t.Fatal("call error:", err)
+		}
+	}
+	var n int64
+	if err := xc.Broadcast(context.Background(), "Counter.Hit", 0, &n); err != nil {
+		t.Fatal("broadcast error:", err)
+	}
+	if n1, n2 := atomic.LoadInt64(&c1.n), atomic.LoadInt64(&c2.n); n1 != 0 || n2 != 11 {
+		t.Fatal("expect every call to go to the serving server, got", n1, n2)
+	}
+
+	var reply int
+
+	_ = d.Update([]string{addr1})
+	time.Sleep(time.Millisecond * 200)
+	err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	if geerpc.CodeOf(err) != geerpc.CodeUnavailable {
+		t.Fatal("expect Unavailable when no server is serving, got", err)
+	}
+
+	s1.SetServingStatus("", geerpc.HealthServing)
+	time.Sleep(time.Millisecond * 200)
+	if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal("expect the server to be used again once serving, got", err)
+	}
+}
+
+func TestRegistry_HealthCheck(t *testing.T) {
+	s1, addr1 := startTestServer(t)
+	_, addr2 := startTestServer(t)
+	r := registry.New(0)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	registry.Heartbeat(ts.URL, addr1, time.Hour)
+	registry.Heartbeat(ts.URL, addr2, time.Hour)
+
+	stop := r.CheckHealth(time.Millisecond*50, nil)
+	defer stop()
+	d := xclient.NewGeeRegistryDiscovery(ts.URL, time.Millisecond)
+
+	s1.SetServingStatus("", geerpc.HealthNotServing)
+	time.Sleep(time.Millisecond * 200)
+	_ = d.Refresh()
+	if servers, _ := d.GetAll(); len(servers) != 1 || servers[0] != addr2 {
+		t.Fatal("expect only the serving server, got", servers)
+	}
+
+	s1.SetServingStatus("", geerpc.HealthServing)
+	time.Sleep(time.Millisecond * 200)
+	if servers, _ := d.GetAll(); len(servers) != 2 {
+		t.Fatal("expect both servers once serving again, got", servers)
+	}
+}
@@ -0,0 +1,29 @@
+package main_test
+
+import (
+	"geerpc/registry"
+	"geerpc/xclient"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Weights(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	defer ts.Close()
+	registry.Heartbeat(ts.URL, "tcp@10.0.0.1:9999;weight=3", time.Hour)
+	registry.Heartbeat(ts.URL, "tcp@10.0.0.2:9999", time.Hour)
+
+	d := xclient.NewGeeRegistryDiscovery(ts.URL, 0)
+	counts := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		addr, err := d.Get(xclient.WeightedRoundRobinSelect)
+		if err != nil {
+			t.Fatal("get error:", err)
+		}
+		counts[addr]++
+	}
+	if counts["tcp@10.0.0.1:9999"] != 6 || counts["tcp@10.0.0.2:9999"] != 2 {
+		t.Fatal("expect the weights from the registry to apply, got", counts)
+	}
+}
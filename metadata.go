@@ -0,0 +1,55 @@
+package geerpc
+
+import (
+	"context"
+	"time"
+)
+
+// Metadata carries request scoped key-value pairs in the request header, like the caller identity
+type Metadata map[string]string
+
+// timeoutKey carries the time left until the deadline of a call, the server won't handle the call for longer
+const timeoutKey = "x-geerpc-timeout"
+
+type (
+	metadataKey         struct{}
+	incomingMetadataKey struct{}
+)
+
+// WithMetadata returns a copy of ctx carrying md, Client.Call sends it along with the request
+func WithMetadata(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// with returns a copy of md with key set to value
+func (md Metadata) with(key, value string) Metadata {
+	c := make(Metadata, len(md)+1)
+	for k, v := range md {
+		c[k] = v
+	}
+	c[key] = value
+	return c
+}
+
+// OutgoingMetadata returns the metadata set on ctx by WithMetadata, without the deadline sent along with it
+func OutgoingMetadata(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md
+}
+
+// metadataFromContext returns the metadata to send with a call made with ctx, including its deadline
+func metadataFromContext(ctx context.Context) Metadata {
+	md := OutgoingMetadata(ctx)
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return md
+	}
+	return md.with(timeoutKey, time.Until(deadline).String())
+}
+
+// MetadataFromContext returns the metadata the server received along with the request,
+// service methods taking a context.Context can read it from there
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(incomingMetadataKey{}).(Metadata)
+	return md
+}
@@ -0,0 +1,228 @@
+package geerpc
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the latency histogram buckets in seconds, like the Prometheus defaults
+var latencyBuckets = [...]float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram counts observed durations in latencyBuckets, the last count is for +Inf
+type histogram struct {
+	counts   [len(latencyBuckets) + 1]uint64
+	sumNanos uint64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := sort.SearchFloat64s(latencyBuckets[:], d.Seconds())
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.sumNanos, uint64(d))
+}
+
+const latencySamples = 1024 // latencies kept to compute percentiles
+
+// latencyWindow keeps the latest latencySamples latencies
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples [latencySamples]time.Duration
+	n       int // number of latencies ever added
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.samples[w.n%latencySamples] = d
+	w.n++
+}
+
+// percentiles returns the latencies at the given percentiles, 0 to 100, of the kept samples
+func (w *latencyWindow) percentiles(ps ...float64) []time.Duration {
+	w.mu.Lock()
+	n := w.n
+	if n > latencySamples {
+		n = latencySamples
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, w.samples[:n])
+	w.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	result := make([]time.Duration, len(ps))
+	if n == 0 {
+		return result
+	}
+	for i, p := range ps {
+		rank := int(p/100*float64(n)+0.5) - 1 // nearest rank
+		if rank < 0 {
+			rank = 0
+		} else if rank >= n {
+			rank = n - 1
+		}
+		result[i] = sorted[rank]
+	}
+	return result
+}
+
+// methodStats are the metrics of one method
+type methodStats struct {
+	inFlight int64                  // handlers running
+	requests uint64                 // finished requests, including rejected ones
+	errors   [len(codeNames)]uint64 // failed requests by code
+	latency  histogram              // time from reading the request to sending its response
+	window   latencyWindow          // latest latencies for percentiles
+
+	mu          sync.Mutex // protect following
+	lastErr     string
+	lastErrTime time.Time
+}
+
+// finish records a request that got a response with the result err after d, rejected requests pass d < 0
+func (m *methodStats) finish(err error, d time.Duration) {
+	atomic.AddUint64(&m.requests, 1)
+	if code := CodeOf(err); code != CodeOK && int(code) < len(m.errors) {
+		atomic.AddUint64(&m.errors[code], 1)
+	}
+	if err != nil {
+		m.mu.Lock()
+		m.lastErr, m.lastErrTime = err.Error(), time.Now()
+		m.mu.Unlock()
+	}
+	if d >= 0 {
+		m.latency.observe(d)
+		m.window.add(d)
+	}
+}
+
+func (m *methodStats) lastError() (string, time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastErr, m.lastErrTime
+}
+
+// serverStats are the connection level metrics of a server
+type serverStats struct {
+	activeConns int64
+	bytesIn     uint64
+	bytesOut    uint64
+}
+
+// countingConn counts the bytes read from and written to a connection
+type countingConn struct {
+	net.Conn
+	stats *serverStats
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddUint64(&c.stats.bytesIn, uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(&c.stats.bytesOut, uint64(n))
+	return n, err
+}
+
+// clientPendingCalls counts the calls of all clients in the process waiting for a response
+var clientPendingCalls int64
+
+// the hedging counters of all HedgePolicys in the process
+var (
+	clientHedges          uint64 // copies sent
+	clientHedgeWins       uint64 // copies which replied first
+	clientHedgesThrottled uint64 // copies not sent for lack of budget
+)
+
+type metricsHTTP struct {
+	*Server
+}
+
+// ServeHTTP writes the metrics of the server in the Prometheus text exposition format
+func (server metricsHTTP) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	server.writeMetrics(w)
+}
+
+func (s *Server) writeMetrics(w io.Writer) {
+	type entry struct {
+		name  string
+		stats *methodStats
+	}
+	var methods []entry
+	s.serviceMap.Range(func(namei, svci interface{}) bool {
+		for name, m := range svci.(*service).method {
+			methods = append(methods, entry{name: namei.(string) + "." + name, stats: &m.stats})
+		}
+		return true
+	})
+	sort.Slice(methods, func(i, j int) bool { return methods[i].name < methods[j].name })
+
+	header := func(name, typ, help string) {
+		_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	header("geerpc_server_requests_total", "counter", "Requests handled or rejected by the server.")
+	for _, m := range methods {
+		_, _ = fmt.Fprintf(w, "geerpc_server_requests_total{method=%s} %d\n",
+			quoteLabel(m.name), atomic.LoadUint64(&m.stats.requests))
+	}
+	header("geerpc_server_errors_total", "counter", "Requests that failed, by error code.")
+	for _, m := range methods {
+		for code := range m.stats.errors {
+			if n := atomic.LoadUint64(&m.stats.errors[code]); n > 0 {
+				_, _ = fmt.Fprintf(w, "geerpc_server_errors_total{method=%s,code=%s} %d\n",
+					quoteLabel(m.name), quoteLabel(Code(code).String()), n)
+			}
+		}
+	}
+	header("geerpc_server_in_flight_requests", "gauge", "Requests being handled.")
+	for _, m := range methods {
+		_, _ = fmt.Fprintf(w, "geerpc_server_in_flight_requests{method=%s} %d\n",
+			quoteLabel(m.name), atomic.LoadInt64(&m.stats.inFlight))
+	}
+	header("geerpc_server_request_duration_seconds", "histogram", "Time from reading a request to sending its response.")
+	for _, m := range methods {
+		h := &m.stats.latency
+		label := quoteLabel(m.name)
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += atomic.LoadUint64(&h.counts[i])
+			_, _ = fmt.Fprintf(w, "geerpc_server_request_duration_seconds_bucket{method=%s,le=\"%s\"} %d\n",
+				label, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		cumulative += atomic.LoadUint64(&h.counts[len(latencyBuckets)])
+		_, _ = fmt.Fprintf(w, "geerpc_server_request_duration_seconds_bucket{method=%s,le=\"+Inf\"} %d\n", label, cumulative)
+		_, _ = fmt.Fprintf(w, "geerpc_server_request_duration_seconds_sum{method=%s} %g\n",
+			label, time.Duration(atomic.LoadUint64(&h.sumNanos)).Seconds())
+		_, _ = fmt.Fprintf(w, "geerpc_server_request_duration_seconds_count{method=%s} %d\n", label, cumulative)
+	}
+	header("geerpc_server_received_bytes_total", "counter", "Bytes read from client connections.")
+	_, _ = fmt.Fprintf(w, "geerpc_server_received_bytes_total %d\n", atomic.LoadUint64(&s.stats.bytesIn))
+	header("geerpc_server_sent_bytes_total", "counter", "Bytes written to client connections.")
+	_, _ = fmt.Fprintf(w, "geerpc_server_sent_bytes_total %d\n", atomic.LoadUint64(&s.stats.bytesOut))
+	header("geerpc_server_active_connections", "gauge", "Client connections being served.")
+	_, _ = fmt.Fprintf(w, "geerpc_server_active_connections %d\n", atomic.LoadInt64(&s.stats.activeConns))
+	header("geerpc_client_pending_calls", "gauge", "Calls of the clients in this process waiting for a response.")
+	_, _ = fmt.Fprintf(w, "geerpc_client_pending_calls %d\n", atomic.LoadInt64(&clientPendingCalls))
+	header("geerpc_client_hedges_total", "counter", "Copies of slow calls sent by hedging clients in this process.")
+	_, _ = fmt.Fprintf(w, "geerpc_client_hedges_total %d\n", atomic.LoadUint64(&clientHedges))
+	header("geerpc_client_hedge_wins_total", "counter", "Hedged copies which replied before the call they copied.")
+	_, _ = fmt.Fprintf(w, "geerpc_client_hedge_wins_total %d\n", atomic.LoadUint64(&clientHedgeWins))
+	header("geerpc_client_hedges_throttled_total", "counter", "Hedged copies not sent because the hedging budget was spent.")
+	_, _ = fmt.Fprintf(w, "geerpc_client_hedges_throttled_total %d\n", atomic.LoadUint64(&clientHedgesThrottled))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
@@ -0,0 +1,44 @@
+package geerpc
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_Metrics(t *testing.T) {
+	s := NewServer(WithHandleTimeout(time.Millisecond * 50))
+	addr := startTestServer(t, s, new(Slow))
+
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	var reply int
+	_ = client.Call(context.Background(), "Slow.Sleep", 0, &reply)
+	_ = client.Call(context.Background(), "Slow.Sleep", 200, &reply) // times out
+
+	rec := httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	text := string(body)
+	for _, line := range []string{
+		`geerpc_server_requests_total{method="Slow.Sleep"} 2`,
+		`geerpc_server_errors_total{method="Slow.Sleep",code="DeadlineExceeded"} 1`,
+		`geerpc_server_request_duration_seconds_bucket{method="Slow.Sleep",le="0.001"} 1`,
+		`geerpc_server_request_duration_seconds_count{method="Slow.Sleep"} 2`,
+		`geerpc_server_in_flight_requests{method="Slow.Sleep"} 1`,
+		`geerpc_server_active_connections 1`,
+		`# TYPE geerpc_client_pending_calls gauge`,
+		`# TYPE geerpc_client_hedges_total counter`,
+	} {
+		_assert(strings.Contains(text, line+"\n"), "expect metrics to contain %q, got:\n%s", line, text)
+	}
+	_assert(!strings.Contains(text, "geerpc_server_received_bytes_total 0\n"), "expect received bytes to be counted")
+}
+
+func TestQuoteLabel(t *testing.T) {
+	_assert(quoteLabel("a\"b\\c\nd") == `"a\"b\\c\nd"`, "expect label value to be escaped")
+}
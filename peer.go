@@ -0,0 +1,50 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+)
+
+// Peer describes the remote side of a server connection
+type Peer struct {
+	Addr        net.Addr
+	Certificate *x509.Certificate // verified client certificate, nil unless mutual TLS is used
+	Identity    string            // common name of Certificate, or its first DNS/URI SAN if the common name is empty
+}
+
+type peerKey struct{}
+
+// PeerFromContext returns the peer of the connection a request was received on
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
+
+func newPeer(conn net.Conn) *Peer {
+	p := &Peer{Addr: conn.RemoteAddr()}
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return p
+	}
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return p
+	}
+	p.Certificate = state.VerifiedChains[0][0]
+	p.Identity = certificateIdentity(p.Certificate)
+	return p
+}
+
+func certificateIdentity(cert *x509.Certificate) string {
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	}
+	return ""
+}
@@ -0,0 +1,241 @@
+package geerpc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// PoolOptions configures a Pool
+type PoolOptions struct {
+	MinConns int // connections kept open even when idle
+	MaxConns int // 0 means 4
+	// MaxPending is the number of pending calls of the least busy connection above which the pool grows, 0 means 16
+	MaxPending int
+	// IdleTimeout closes the connections beyond MinConns which had no call for this long, 0 means never
+	IdleTimeout time.Duration
+}
+
+// Pool is a client holding several connections to one address, every call goes to the connection with the
+// fewest pending calls. Large payloads on one connection then don't hold up the calls on the others.
+type Pool struct {
+	rpcAddr string
+	opt     *Option
+	popts   PoolOptions
+
+	mu      sync.Mutex // protect following
+	conns   []*pooledConn
+	dialing int        // connections being dialed
+	dialed  *sync.Cond // broadcast when a dial is done or the pool is closed
+	closed  bool
+	done    chan struct{} // closed by Close
+	types   TypeChecker
+}
+
+type pooledConn struct {
+	client   *Client
+	lastUsed time.Time
+}
+
+var _ TypedCaller = (*Pool)(nil)
+
+// NewPool dials popts.MinConns connections to rpcAddr, an address accepted by XDial, and returns the pool.
+// It fails if any of them can't be dialed.
+func NewPool(rpcAddr string, popts PoolOptions, opts ...*Option) (*Pool, error) {
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if popts.MaxConns <= 0 {
+		popts.MaxConns = 4
+	}
+	if popts.MaxPending <= 0 {
+		popts.MaxPending = 16
+	}
+	if popts.MinConns > popts.MaxConns {
+		popts.MinConns = popts.MaxConns
+	}
+	p := &Pool{rpcAddr: rpcAddr, opt: opt, popts: popts, done: make(chan struct{})}
+	p.dialed = sync.NewCond(&p.mu)
+	for i := 0; i < popts.MinConns; i++ {
+		p.dialing++
+		if _, err := p.dial(); err != nil {
+			_ = p.Close()
+			return nil, err
+		}
+	}
+	go p.maintain()
+	return p, nil
+}
+
+// dial adds a connection to the pool, the caller has counted it in p.dialing
+func (p *Pool) dial() (*Client, error) {
+	client, err := XDial(p.rpcAddr, p.opt.withoutRetry())
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dialing--
+	p.dialed.Broadcast()
+	if err != nil {
+		return nil, NotSent(err)
+	}
+	if p.closed {
+		_ = client.Close()
+		return nil, ErrShutdown
+	}
+	p.conns = append(p.conns, &pooledConn{client: client, lastUsed: time.Now()})
+	return client, nil
+}
+
+// prune drops the lost connections, p.mu must be held
+func (p *Pool) prune() {
+	conns := p.conns[:0]
+	for _, pc := range p.conns {
+		if pc.client.IsAvailable() {
+			conns = append(conns, pc)
+		}
+	}
+	for i := len(conns); i < len(p.conns); i++ {
+		p.conns[i] = nil
+	}
+	p.conns = conns
+}
+
+// pick returns the connection with the fewest pending calls. The pool grows in the background when even that one
+// has MaxPending calls, and dials in the foreground when it has no connection, or waits for the dials in flight
+// if they already reach MaxConns.
+func (p *Pool) pick() (*Client, error) {
+	p.mu.Lock()
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrShutdown
+		}
+		p.prune()
+		if len(p.conns) > 0 || p.dialing < p.popts.MaxConns {
+			break
+		}
+		p.dialed.Wait()
+	}
+	var best *pooledConn
+	pending := 0
+	for _, pc := range p.conns {
+		if n := pc.client.NumPending(); best == nil || n < pending {
+			best, pending = pc, n
+		}
+	}
+	grow := best == nil || (pending >= p.popts.MaxPending && len(p.conns)+p.dialing < p.popts.MaxConns)
+	if grow {
+		p.dialing++
+	}
+	if best != nil {
+		best.lastUsed = time.Now()
+	}
+	p.mu.Unlock()
+	if best == nil {
+		return p.dial()
+	}
+	if grow {
+		go func() { _, _ = p.dial() }()
+	}
+	return best.client, nil
+}
+
+// maintain closes idle connections beyond MinConns and dials back up to MinConns, until the pool is closed
+func (p *Pool) maintain() {
+	interval := time.Second
+	if p.popts.IdleTimeout > 0 {
+		interval = p.popts.IdleTimeout / 2
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+		}
+		p.mu.Lock()
+		p.prune()
+		if p.popts.IdleTimeout > 0 {
+			open := len(p.conns)
+			conns := p.conns[:0]
+			for _, pc := range p.conns {
+				idle := pc.client.NumPending() == 0 && time.Since(pc.lastUsed) >= p.popts.IdleTimeout
+				if idle && open > p.popts.MinConns {
+					_ = pc.client.Close()
+					open--
+					continue
+				}
+				conns = append(conns, pc)
+			}
+			p.conns = conns
+		}
+		missing := p.popts.MinConns - len(p.conns) - p.dialing
+		if missing > 0 {
+			p.dialing += missing
+		}
+		p.mu.Unlock()
+		for i := 0; i < missing; i++ {
+			go func() { _, _ = p.dial() }()
+		}
+	}
+}
+
+// Len returns the number of open connections
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prune()
+	return len(p.conns)
+}
+
+// NumPending returns the number of calls waiting for a reply on all connections
+func (p *Pool) NumPending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, pc := range p.conns {
+		n += pc.client.NumPending()
+	}
+	return n
+}
+
+// Call is like Client.Call on the connection with the fewest pending calls, retries pick a connection again
+func (p *Pool) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	return p.opt.RetryPolicy.Do(ctx, serviceMethod, func() error {
+		client, err := p.pick()
+		if err != nil {
+			return err
+		}
+		return client.Call(ctx, serviceMethod, args, reply)
+	})
+}
+
+// TypeChecker returns the cache of the type checks of CallT
+func (p *Pool) TypeChecker() *TypeChecker {
+	return &p.types
+}
+
+// IsAvailable reports whether the pool is open
+func (p *Pool) IsAvailable() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.closed
+}
+
+// Close closes every connection, calls in flight fail
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrShutdown
+	}
+	p.closed = true
+	close(p.done)
+	p.dialed.Broadcast()
+	for _, pc := range p.conns {
+		_ = pc.client.Close()
+	}
+	p.conns = nil
+	return nil
+}
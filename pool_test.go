@@ -0,0 +1,70 @@
+package geerpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	addr := startTestServer(t, NewServer(), new(Slow))
+
+	p, err := NewPool("tcp@"+addr, PoolOptions{MinConns: 1, MaxConns: 3, MaxPending: 1, IdleTimeout: time.Millisecond * 100})
+	_assert(err == nil, "new pool error: %v", err)
+	defer func() { _ = p.Close() }()
+	_assert(p.Len() == 1, "expect MinConns connections, got %d", p.Len())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply int
+			err := p.Call(context.Background(), "Slow.Sleep", 50, &reply)
+			_assert(err == nil && reply == 50, "expect 50, got %d, %v", reply, err)
+		}()
+		time.Sleep(time.Millisecond * 2)
+	}
+	time.Sleep(time.Millisecond * 20)
+	n := p.Len()
+	_assert(n == 3, "expect the pool to grow to MaxConns under load, got %d", n)
+	_assert(p.NumPending() > 0, "expect pending calls")
+	wg.Wait()
+
+	time.Sleep(time.Millisecond * 300)
+	_assert(p.Len() == 1, "expect idle connections beyond MinConns to be closed, got %d", p.Len())
+
+	_ = p.Close()
+	var reply int
+	err = p.Call(context.Background(), "Slow.Sleep", 0, &reply)
+	_assert(err == ErrShutdown, "expect ErrShutdown after Close, got %v", err)
+}
+
+func TestPool_ConcurrentFirstCalls(t *testing.T) {
+	addr := startTestServer(t, NewServer(), new(Slow))
+
+	p, err := NewPool("tcp@"+addr, PoolOptions{MaxConns: 2})
+	_assert(err == nil, "new pool error: %v", err)
+	defer func() { _ = p.Close() }()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply int
+			err := p.Call(context.Background(), "Slow.Sleep", 1, &reply)
+			_assert(err == nil && reply == 1, "expect 1, got %d, %v", reply, err)
+		}()
+	}
+	wg.Wait()
+	_assert(p.Len() <= 2, "expect at most MaxConns connections, got %d", p.Len())
+}
+
+func TestNewPool_DialError(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	_ = l.Close()
+	_, err := NewPool("tcp@"+l.Addr().String(), PoolOptions{MinConns: 1})
+	_assert(err != nil, "expect an error when the first connections can't be dialed")
+}
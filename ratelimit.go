@@ -0,0 +1,92 @@
+package geerpc
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimit configures a token bucket for a method: Rate tokens are added per second, up to Burst tokens.
+type RateLimit struct {
+	Rate  float64 // tokens added per second
+	Burst int     // capacity of the bucket, at least 1
+	Key   string  // metadata key identifying the caller, every caller gets its own bucket; empty means one shared bucket
+}
+
+const maxIdleBuckets = 1024 // prune full buckets once a limiter tracks more callers than this
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter holds the buckets of one Service.Method
+type rateLimiter struct {
+	limit   RateLimit
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket // caller -> bucket
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &rateLimiter{limit: limit, buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from the bucket of caller, it reports false if the bucket is empty
+func (l *rateLimiter) allow(caller string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	burst := float64(l.limit.Burst)
+	b := l.buckets[caller]
+	if b == nil {
+		if len(l.buckets) >= maxIdleBuckets {
+			l.prune(now)
+		}
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[caller] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate) // refill
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune drops the buckets that have refilled, they are no different from new ones
+func (l *rateLimiter) prune(now time.Time) {
+	burst := float64(l.limit.Burst)
+	for caller, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate >= burst {
+			delete(l.buckets, caller)
+		}
+	}
+}
+
+// WithRateLimit limits the calls of serviceMethod, e.g. "Foo.Sum", calls over the limit fail with CodeResourceExhausted
+func WithRateLimit(serviceMethod string, limit RateLimit) ServerOption {
+	return func(s *Server) {
+		s.limiters[serviceMethod] = newRateLimiter(limit)
+	}
+}
+
+// checkRateLimit takes a token for req, it returns an error if the caller is over the limit
+func (s *Server) checkRateLimit(req *request) error {
+	l := s.limiters[req.h.ServiceMethod]
+	if l == nil {
+		return nil
+	}
+	var caller string
+	if l.limit.Key != "" {
+		caller = req.md[l.limit.Key]
+	}
+	if l.allow(caller, time.Now()) {
+		return nil
+	}
+	atomic.AddUint64(&req.mtype.numRejected, 1)
+	return Errorf(CodeResourceExhausted, "rpc server: rate limit exceeded: %s", req.h.ServiceMethod)
+}
@@ -0,0 +1,50 @@
+package geerpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_allow(t *testing.T) {
+	l := newRateLimiter(RateLimit{Rate: 10, Burst: 2})
+	now := time.Now()
+	_assert(l.allow("", now) && l.allow("", now), "expect burst of 2 to be allowed")
+	_assert(!l.allow("", now), "expect empty bucket to reject")
+	_assert(l.allow("", now.Add(100*time.Millisecond)), "expect one token after 100ms at 10/s")
+	_assert(!l.allow("", now.Add(100*time.Millisecond)), "expect empty bucket to reject")
+	_assert(l.allow("other", now), "expect callers to have their own bucket")
+}
+
+func TestRateLimiter_prune(t *testing.T) {
+	l := newRateLimiter(RateLimit{Rate: 1, Burst: 1})
+	now := time.Now()
+	for i := 0; i < maxIdleBuckets; i++ {
+		l.allow(string(rune(i)), now)
+	}
+	l.allow("late", now.Add(time.Second))
+	_assert(len(l.buckets) == 1, "expect refilled buckets to be pruned, got %d", len(l.buckets))
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	s := NewServer(WithRateLimit("Foo.Sum", RateLimit{Rate: 0.001, Burst: 2, Key: "tenant"}))
+	addr := startTestServer(t, s, new(Foo))
+
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	call := func(tenant string) error {
+		var reply int
+		ctx := WithMetadata(context.Background(), Metadata{"tenant": tenant})
+		return client.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	}
+	_assert(call("a") == nil && call("a") == nil, "expect calls within burst to succeed")
+	err = call("a")
+	_assert(CodeOf(err) == CodeResourceExhausted, "expect ResourceExhausted, got %v", err)
+	_assert(call("b") == nil, "expect another tenant to have its own bucket")
+
+	_, mtype, _ := s.findService("Foo.Sum")
+	_assert(mtype.NumRejected() == 1 && mtype.NumCalls() == 3, "expect 1 rejected and 3 calls, got %d and %d",
+		mtype.NumRejected(), mtype.NumCalls())
+}
@@ -0,0 +1,277 @@
+package geerpc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ConnState is the state of the connection of a ReconnectingClient
+type ConnState int
+
+const (
+	StateConnecting       ConnState = iota // dialing and sending the options
+	StateReady                             // calls are sent
+	StateTransientFailure                  // the connection failed or was lost, waiting to redial
+	StateShutdown                          // the client is closed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnecting:
+		return "CONNECTING"
+	case StateReady:
+		return "READY"
+	case StateTransientFailure:
+		return "TRANSIENT_FAILURE"
+	case StateShutdown:
+		return "SHUTDOWN"
+	default:
+		return fmt.Sprintf("ConnState(%d)", int(s))
+	}
+}
+
+// Backoff is an exponential backoff with jitter:
+// the n-th retry waits min(BaseDelay * Multiplier^n, MaxDelay), randomly spread by ±Jitter of it.
+type Backoff struct {
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	Multiplier float64
+	Jitter     float64 // between 0 and 1
+}
+
+var DefaultBackoff = Backoff{
+	BaseDelay:  time.Millisecond * 100,
+	MaxDelay:   time.Second * 30,
+	Multiplier: 1.6,
+	Jitter:     0.2,
+}
+
+// Delay returns how long to wait before the retry after n failed ones
+func (b Backoff) Delay(n int) time.Duration {
+	d := math.Min(float64(b.BaseDelay)*math.Pow(b.Multiplier, float64(n)), float64(b.MaxDelay))
+	d *= 1 + b.Jitter*(rand.Float64()*2-1)
+	if d < 0 {
+		return 0
+	}
+	return time.Duration(d)
+}
+
+// ReconnectOptions configures a ReconnectingClient
+type ReconnectOptions struct {
+	Backoff Backoff // zero value means DefaultBackoff
+	// FailFast makes calls fail with CodeUnavailable while the client isn't ready,
+	// instead of waiting for the connection until their context is done.
+	FailFast bool
+	// OnStateChange is called with every new state, in order, it must not block
+	OnStateChange func(ConnState)
+}
+
+// ReconnectingClient is a client which redials its address whenever the connection fails,
+// with exponential backoff. Every connection replays the handshake with the same Option.
+// Calls in flight when the connection is lost fail, later calls go to the new connection.
+type ReconnectingClient struct {
+	rpcAddr string
+	opt     *Option
+	ropts   ReconnectOptions
+	logger  *slog.Logger
+
+	notify sync.Mutex // keeps the OnStateChange calls in order
+	mu     sync.Mutex // protect following
+	client *Client    // the ready client, or nil
+	state  ConnState
+	ready  chan struct{} // closed when the client gets ready
+	done   chan struct{} // closed by Close
+	types  TypeChecker
+}
+
+var _ TypedCaller = (*ReconnectingClient)(nil)
+
+// NewReconnectingClient returns a client of rpcAddr, an address accepted by XDial. It connects in the background,
+// calls wait for the connection unless ropts.FailFast is set.
+func NewReconnectingClient(rpcAddr string, ropts ReconnectOptions, opts ...*Option) (*ReconnectingClient, error) {
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if ropts.Backoff == (Backoff{}) {
+		ropts.Backoff = DefaultBackoff
+	}
+	rc := &ReconnectingClient{
+		rpcAddr: rpcAddr,
+		opt:     opt,
+		ropts:   ropts,
+		logger:  loggerOf(opt).With("addr", rpcAddr),
+		state:   StateConnecting,
+		ready:   make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if ropts.OnStateChange != nil {
+		ropts.OnStateChange(StateConnecting)
+	}
+	go rc.run()
+	return rc, nil
+}
+
+// setState moves to state, client is the ready client if state is StateReady.
+// It returns false if the client has been closed.
+func (rc *ReconnectingClient) setState(state ConnState, client *Client) bool {
+	rc.notify.Lock()
+	defer rc.notify.Unlock()
+	rc.mu.Lock()
+	if rc.state == StateShutdown {
+		rc.mu.Unlock()
+		return false
+	}
+	changed := rc.state != state
+	rc.state = state
+	rc.client = client
+	if state == StateReady {
+		close(rc.ready)
+	} else {
+		select {
+		case <-rc.ready: // was ready, calls must wait for the next connection
+			rc.ready = make(chan struct{})
+		default:
+		}
+	}
+	rc.mu.Unlock()
+	if changed {
+		rc.logger.Info("rpc client: connection state", "state", state.String())
+		if rc.ropts.OnStateChange != nil {
+			rc.ropts.OnStateChange(state)
+		}
+	}
+	return true
+}
+
+// run dials until the client is closed. A connection lost after being stable for MaxDelay is redialed at once,
+// otherwise the backoff keeps growing.
+func (rc *ReconnectingClient) run() {
+	retries := 0
+	for {
+		if retries > 0 {
+			t := time.NewTimer(rc.ropts.Backoff.Delay(retries - 1))
+			select {
+			case <-rc.done:
+				t.Stop()
+				return
+			case <-t.C:
+			}
+			if !rc.setState(StateConnecting, nil) {
+				return
+			}
+		}
+		client, err := XDial(rc.rpcAddr, rc.opt.withoutRetry())
+		if err != nil {
+			rc.logger.Warn("rpc client: dial error", "err", err, "retries", retries)
+			retries++
+			if !rc.setState(StateTransientFailure, nil) {
+				return
+			}
+			continue
+		}
+		if !rc.setState(StateReady, client) {
+			_ = client.Close()
+			return
+		}
+		readyAt := time.Now()
+		select {
+		case <-rc.done:
+			_ = client.Close()
+			return
+		case <-client.done: // the connection is lost
+		}
+		if time.Since(readyAt) >= rc.ropts.Backoff.MaxDelay {
+			retries = 0
+		} else {
+			retries++
+		}
+		if !rc.setState(StateTransientFailure, nil) {
+			return
+		}
+		if retries == 0 && !rc.setState(StateConnecting, nil) {
+			return
+		}
+	}
+}
+
+// State returns the current state of the connection
+func (rc *ReconnectingClient) State() ConnState {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.state
+}
+
+// get returns the ready client, waiting for it unless FailFast is set
+func (rc *ReconnectingClient) get(ctx context.Context) (*Client, error) {
+	for {
+		rc.mu.Lock()
+		state, client, ready := rc.state, rc.client, rc.ready
+		rc.mu.Unlock()
+		switch {
+		case state == StateShutdown:
+			return nil, ErrShutdown
+		case state == StateReady && client.IsAvailable():
+			return client, nil
+		case rc.ropts.FailFast:
+			return nil, NotSent(Errorf(CodeUnavailable, "rpc client: connection to %s is %s", rc.rpcAddr, state))
+		case state == StateReady: // the connection is being lost
+			ready = client.done
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("rpc client: call failed: %s", ctx.Err())
+		case <-rc.done:
+			return nil, ErrShutdown
+		case <-ready:
+			if state == StateReady {
+				runtime.Gosched() // let run move to the next state
+			}
+		}
+	}
+}
+
+// Call is like Client.Call on the current connection, retries wait for the next one if it is lost
+func (rc *ReconnectingClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	return rc.opt.RetryPolicy.Do(ctx, serviceMethod, func() error {
+		client, err := rc.get(ctx)
+		if err != nil {
+			return err
+		}
+		return client.Call(ctx, serviceMethod, args, reply)
+	})
+}
+
+// TypeChecker returns the cache of the type checks of CallT
+func (rc *ReconnectingClient) TypeChecker() *TypeChecker {
+	return &rc.types
+}
+
+// Close closes the connection and stops redialing, waiting calls fail with ErrShutdown
+func (rc *ReconnectingClient) Close() error {
+	rc.notify.Lock()
+	defer rc.notify.Unlock()
+	rc.mu.Lock()
+	if rc.state == StateShutdown {
+		rc.mu.Unlock()
+		return ErrShutdown
+	}
+	rc.state = StateShutdown
+	client := rc.client
+	rc.client = nil
+	close(rc.done)
+	rc.mu.Unlock()
+	if client != nil {
+		_ = client.Close()
+	}
+	if rc.ropts.OnStateChange != nil {
+		rc.ropts.OnStateChange(StateShutdown)
+	}
+	return nil
+}
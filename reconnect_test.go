@@ -0,0 +1,109 @@
+package geerpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// trackingListener keeps the accepted connections, so that tests can break them
+type trackingListener struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, conn)
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+// breakAll closes the listener and every accepted connection
+func (l *trackingListener) breakAll() {
+	_ = l.Close()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, conn := range l.conns {
+		_ = conn.Close()
+	}
+}
+
+func startFooServer(t *testing.T, addr string) *trackingListener {
+	l, err := net.Listen("tcp", addr)
+	_assert(err == nil, "listen error: %v", err)
+	tl := &trackingListener{Listener: l}
+	serveTest(t, NewServer(), tl, new(Foo))
+	return tl
+}
+
+func TestReconnectingClient(t *testing.T) {
+	l := startFooServer(t, "127.0.0.1:0")
+	addr := l.Addr().String()
+	var mu sync.Mutex
+	var states []ConnState
+	rc, err := NewReconnectingClient("tcp@"+addr, ReconnectOptions{
+		Backoff: Backoff{BaseDelay: time.Millisecond * 10, MaxDelay: time.Millisecond * 50, Multiplier: 2, Jitter: 0.1},
+		OnStateChange: func(s ConnState) {
+			mu.Lock()
+			defer mu.Unlock()
+			states = append(states, s)
+		},
+	})
+	_assert(err == nil, "new client error: %v", err)
+
+	var reply int
+	err = rc.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "expect 3, got %d, %v", reply, err)
+	_assert(rc.State() == StateReady, "expect READY, got %s", rc.State())
+
+	l.breakAll()
+	time.Sleep(time.Millisecond * 100)
+	_assert(rc.State() != StateReady, "expect the lost connection to be noticed")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err = rc.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err != nil, "expect the call to wait for the connection until the context is done")
+
+	l = startFooServer(t, addr)
+	defer l.breakAll()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = rc.Call(ctx, "Foo.Sum", Args{Num1: 2, Num2: 2}, &reply)
+	_assert(err == nil && reply == 4, "expect the call to go to the new connection, got %d, %v", reply, err)
+
+	_ = rc.Close()
+	err = rc.Call(context.Background(), "Foo.Sum", Args{}, &reply)
+	_assert(err == ErrShutdown, "expect ErrShutdown after Close, got %v", err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	_assert(len(states) >= 6 && states[0] == StateConnecting && states[1] == StateReady && states[2] == StateTransientFailure,
+		"expect to connect then fail, got %v", states)
+	_assert(states[len(states)-2] == StateReady && states[len(states)-1] == StateShutdown, "expect to be ready again then shut down, got %v", states)
+}
+
+func TestReconnectingClient_FailFast(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	_ = l.Close() // nothing listens on addr
+	rc, _ := NewReconnectingClient("tcp@"+addr, ReconnectOptions{FailFast: true})
+	defer func() { _ = rc.Close() }()
+	var reply int
+	err := rc.Call(context.Background(), "Foo.Sum", Args{}, &reply)
+	_assert(CodeOf(err) == CodeUnavailable, "expect Unavailable, got %v", err)
+}
+
+func TestBackoff_Delay(t *testing.T) {
+	b := Backoff{BaseDelay: time.Second, MaxDelay: time.Second * 10, Multiplier: 2, Jitter: 0.1}
+	for n, want := range []time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 8, time.Second * 10, time.Second * 10} {
+		d := b.Delay(n)
+		_assert(d >= want*9/10 && d <= want*11/10, "expect delay %d around %s, got %s", n, want, d)
+	}
+}
@@ -0,0 +1,309 @@
+package geerpc
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReflectionService is the name of the built-in service describing the services of a server,
+// e.g. call "_reflection.ListServices" and "_reflection.DescribeService" to learn what to call
+const ReflectionService = "_reflection"
+
+// TypeSchema describes an argument or reply type, as derived from its reflect.Type
+type TypeSchema struct {
+	Name   string        // e.g. "int" or "main.Args", empty for unnamed types like []int
+	Kind   string        // reflect.Kind, e.g. "struct", "ptr", "slice"
+	Elem   *TypeSchema   // element type of a pointer, slice, array, map or channel
+	Key    *TypeSchema   // key type of a map
+	Len    int           // length of an array
+	Fields []FieldSchema // exported fields of a struct, not repeated for a struct already described higher up
+}
+
+// FieldSchema describes a struct field
+type FieldSchema struct {
+	Name string
+	Type *TypeSchema
+}
+
+// MethodDescriptor describes a method of a service
+type MethodDescriptor struct {
+	Name      string
+	ArgType   *TypeSchema
+	ReplyType *TypeSchema
+}
+
+// ServiceDescriptor describes a registered service, its methods are sorted by name
+type ServiceDescriptor struct {
+	Name    string
+	Methods []MethodDescriptor
+}
+
+// Method returns the descriptor of the method name, or nil
+func (d *ServiceDescriptor) Method(name string) *MethodDescriptor {
+	for i := range d.Methods {
+		if d.Methods[i].Name == name {
+			return &d.Methods[i]
+		}
+	}
+	return nil
+}
+
+// newTypeSchema describes typ, seen holds the structs being described to stop on recursive types
+func newTypeSchema(typ reflect.Type, seen map[reflect.Type]bool) *TypeSchema {
+	ts := &TypeSchema{Name: typ.String(), Kind: typ.Kind().String()}
+	if typ.Name() == "" {
+		ts.Name = ""
+	}
+	switch typ.Kind() {
+	case reflect.Array:
+		ts.Len = typ.Len()
+		ts.Elem = newTypeSchema(typ.Elem(), seen)
+	case reflect.Ptr, reflect.Slice, reflect.Chan:
+		ts.Elem = newTypeSchema(typ.Elem(), seen)
+	case reflect.Map:
+		ts.Key = newTypeSchema(typ.Key(), seen)
+		ts.Elem = newTypeSchema(typ.Elem(), seen)
+	case reflect.Struct:
+		if seen[typ] {
+			return ts
+		}
+		seen[typ] = true
+		defer delete(seen, typ)
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			if f.PkgPath != "" { // unexported fields are not sent by the codecs
+				continue
+			}
+			ts.Fields = append(ts.Fields, FieldSchema{Name: f.Name, Type: newTypeSchema(f.Type, seen)})
+		}
+	}
+	return ts
+}
+
+var (
+	kinds      = make(map[string]reflect.Kind) // reflect.Kind.String() -> reflect.Kind
+	basicTypes = map[reflect.Kind]reflect.Type{
+		reflect.Bool:       reflect.TypeOf(false),
+		reflect.Int:        reflect.TypeOf(int(0)),
+		reflect.Int8:       reflect.TypeOf(int8(0)),
+		reflect.Int16:      reflect.TypeOf(int16(0)),
+		reflect.Int32:      reflect.TypeOf(int32(0)),
+		reflect.Int64:      reflect.TypeOf(int64(0)),
+		reflect.Uint:       reflect.TypeOf(uint(0)),
+		reflect.Uint8:      reflect.TypeOf(uint8(0)),
+		reflect.Uint16:     reflect.TypeOf(uint16(0)),
+		reflect.Uint32:     reflect.TypeOf(uint32(0)),
+		reflect.Uint64:     reflect.TypeOf(uint64(0)),
+		reflect.Uintptr:    reflect.TypeOf(uintptr(0)),
+		reflect.Float32:    reflect.TypeOf(float32(0)),
+		reflect.Float64:    reflect.TypeOf(float64(0)),
+		reflect.Complex64:  reflect.TypeOf(complex64(0)),
+		reflect.Complex128: reflect.TypeOf(complex128(0)),
+		reflect.String:     reflect.TypeOf(""),
+		reflect.Interface:  reflect.TypeOf((*interface{})(nil)).Elem(),
+	}
+)
+
+func init() {
+	for k := reflect.Invalid; k <= reflect.UnsafePointer; k++ {
+		kinds[k.String()] = k
+	}
+}
+
+// Type builds an unnamed type with the structure described by ts, e.g. struct { Num1 int; Num2 int } for main.Args.
+// Values of it are encoded like values of the described type, so that dynamic clients can call methods
+// without the types at compile time. A struct already described higher up is built without fields.
+func (ts *TypeSchema) Type() (reflect.Type, error) {
+	kind := kinds[ts.Kind]
+	if typ, ok := basicTypes[kind]; ok {
+		return typ, nil
+	}
+	var elem, key reflect.Type
+	var err error
+	if ts.Elem != nil {
+		if elem, err = ts.Elem.Type(); err != nil {
+			return nil, err
+		}
+	}
+	if ts.Key != nil {
+		if key, err = ts.Key.Type(); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case kind == reflect.Ptr && elem != nil:
+		return reflect.PtrTo(elem), nil
+	case kind == reflect.Slice && elem != nil:
+		return reflect.SliceOf(elem), nil
+	case kind == reflect.Array && elem != nil:
+		return reflect.ArrayOf(ts.Len, elem), nil
+	case kind == reflect.Map && elem != nil && key != nil:
+		return reflect.MapOf(key, elem), nil
+	case kind == reflect.Struct:
+		fields := make([]reflect.StructField, 0, len(ts.Fields))
+		for _, f := range ts.Fields {
+			typ, err := f.Type.Type()
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, reflect.StructField{Name: f.Name, Type: typ})
+		}
+		return reflect.StructOf(fields), nil
+	}
+	return nil, fmt.Errorf("rpc reflection: can't build a type of kind %q", ts.Kind)
+}
+
+// String formats ts like a Go type, by name if it has one
+func (ts *TypeSchema) String() string {
+	if ts.Name != "" {
+		return ts.Name
+	}
+	switch kinds[ts.Kind] {
+	case reflect.Ptr:
+		return "*" + ts.Elem.String()
+	case reflect.Slice:
+		return "[]" + ts.Elem.String()
+	case reflect.Array:
+		return "[" + strconv.Itoa(ts.Len) + "]" + ts.Elem.String()
+	case reflect.Map:
+		return "map[" + ts.Key.String() + "]" + ts.Elem.String()
+	case reflect.Chan:
+		return "chan " + ts.Elem.String()
+	case reflect.Struct:
+		fields := make([]string, len(ts.Fields))
+		for i, f := range ts.Fields {
+			fields[i] = f.Name + " " + f.Type.String()
+		}
+		return "struct { " + strings.Join(fields, "; ") + " }"
+	}
+	return ts.Kind
+}
+
+func newServiceDescriptor(svc *service) ServiceDescriptor {
+	d := ServiceDescriptor{Name: svc.name}
+	for name, m := range svc.method {
+		d.Methods = append(d.Methods, MethodDescriptor{
+			Name:      name,
+			ArgType:   newTypeSchema(m.ArgType, make(map[reflect.Type]bool)),
+			ReplyType: newTypeSchema(m.ReplyType, make(map[reflect.Type]bool)),
+		})
+	}
+	sort.Slice(d.Methods, func(i, j int) bool { return d.Methods[i].Name < d.Methods[j].Name })
+	return d
+}
+
+// reflectionService is registered on every server as ReflectionService
+type reflectionService struct {
+	server *Server
+}
+
+// ListServices replies the sorted names of the registered services, including ReflectionService
+func (r reflectionService) ListServices(_ int, names *[]string) error {
+	r.server.serviceMap.Range(func(namei, _ interface{}) bool {
+		*names = append(*names, namei.(string))
+		return true
+	})
+	sort.Strings(*names)
+	return nil
+}
+
+// DescribeService replies the methods of the service name and the schemas of their types
+func (r reflectionService) DescribeService(name string, desc *ServiceDescriptor) error {
+	svci, ok := r.server.serviceMap.Load(name)
+	if !ok {
+		return Errorf(CodeNotFound, "rpc server: can't find service %s", name)
+	}
+	*desc = newServiceDescriptor(svci.(*service))
+	return nil
+}
+
+// registerReflection registers the reflection service of s
+func (s *Server) registerReflection() {
+	svc := newService(reflectionService{server: s}, s.logger)
+	svc.name = ReflectionService
+	_ = s.register(svc)
+}
+
+// kindClass groups the kinds whose values the codecs convert between, e.g. int32 and int64
+func kindClass(k reflect.Kind) string {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "uint"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Complex64, reflect.Complex128:
+		return "complex"
+	}
+	return k.String()
+}
+
+// compatible returns why values of the local type typ can't be exchanged with values of the remote type ts, nil if
+// they can. Pointers are followed on both sides, every field of a local struct must be known to the remote struct.
+func compatible(typ reflect.Type, ts *TypeSchema, path string) error {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	for kinds[ts.Kind] == reflect.Ptr && ts.Elem != nil {
+		ts = ts.Elem
+	}
+	if typ.Kind() == reflect.Interface {
+		return nil
+	}
+	if kindClass(typ.Kind()) != kindClass(kinds[ts.Kind]) {
+		return fmt.Errorf("%s: %s doesn't match %s", path, typ, ts)
+	}
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array:
+		if ts.Elem != nil {
+			return compatible(typ.Elem(), ts.Elem, path+"[]")
+		}
+	case reflect.Map:
+		if ts.Key != nil && ts.Elem != nil {
+			if err := compatible(typ.Key(), ts.Key, path+" key"); err != nil {
+				return err
+			}
+			return compatible(typ.Elem(), ts.Elem, path+"[]")
+		}
+	case reflect.Struct:
+		if len(ts.Fields) == 0 { // may be a struct described higher up
+			return nil
+		}
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			var remote *TypeSchema
+			for _, rf := range ts.Fields {
+				if rf.Name == f.Name {
+					remote = rf.Type
+				}
+			}
+			if remote == nil {
+				return fmt.Errorf("%s.%s: no such field in %s", path, f.Name, ts)
+			}
+			if err := compatible(f.Type, remote, path+"."+f.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CheckTypes returns an error with CodeInvalidArgument if args and reply values of the local types can't be exchanged
+// with the method, e.g. a field of the args is unknown to the server, and would silently be dropped.
+func (d *MethodDescriptor) CheckTypes(args, reply reflect.Type) error {
+	err := compatible(args, d.ArgType, "args")
+	if err == nil {
+		err = compatible(reply, d.ReplyType, "reply")
+	}
+	if err != nil {
+		return Errorf(CodeInvalidArgument, "rpc client: types don't match method %s(%s, %s): %v", d.Name, d.ArgType, d.ReplyType, err)
+	}
+	return nil
+}
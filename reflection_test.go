@@ -0,0 +1,76 @@
+package geerpc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type Tree struct {
+	Value    int
+	Children []*Tree
+	Labels   map[string]bool
+	hidden   int
+}
+
+type Forest int
+
+func (f Forest) Grow(args Tree, reply *[]Tree) error {
+	return nil
+}
+
+func TestReflectionService(t *testing.T) {
+	addr := startTestServer(t, NewServer(), new(Forest))
+
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var names []string
+	err = client.Call(context.Background(), ReflectionService+".ListServices", 0, &names)
+	_assert(err == nil && len(names) == 3 && names[0] == "Forest" && names[1] == HealthService && names[2] == ReflectionService,
+		"expect Forest, %s and %s, got %v, %v", HealthService, ReflectionService, names, err)
+
+	var desc ServiceDescriptor
+	err = client.Call(context.Background(), ReflectionService+".DescribeService", "Forest", &desc)
+	_assert(err == nil, "describe error: %v", err)
+	grow := desc.Method("Grow")
+	_assert(desc.Name == "Forest" && len(desc.Methods) == 1 && grow != nil, "expect method Grow, got %+v", desc)
+
+	arg := grow.ArgType
+	_assert(arg.Name == "geerpc.Tree" && arg.Kind == "struct" && len(arg.Fields) == 3, "expect the exported fields of Tree, got %+v", arg)
+	_assert(arg.Fields[0].Name == "Value" && arg.Fields[0].Type.Kind == "int", "expect Value int, got %+v", arg.Fields[0])
+	children := arg.Fields[1].Type
+	_assert(children.Kind == "slice" && children.Name == "" && children.Elem.Kind == "ptr" && children.Elem.Elem.Name == "geerpc.Tree",
+		"expect []*Tree, got %+v", children)
+	_assert(len(children.Elem.Elem.Fields) == 0, "expect the recursive type not to be expanded again")
+	labels := arg.Fields[2].Type
+	_assert(labels.Kind == "map" && labels.Key.Kind == "string" && labels.Elem.Kind == "bool", "expect map[string]bool, got %+v", labels)
+
+	reply := grow.ReplyType
+	_assert(reply.Kind == "ptr" && reply.Elem.Kind == "slice" && reply.Elem.Elem.Name == "geerpc.Tree" && len(reply.Elem.Elem.Fields) == 3,
+		"expect *[]Tree, got %+v", reply)
+
+	err = client.Call(context.Background(), ReflectionService+".DescribeService", "Missing", &desc)
+	_assert(CodeOf(err) == CodeNotFound, "expect NotFound, got %v", err)
+}
+
+func TestTypeSchema_Type(t *testing.T) {
+	type Inner struct {
+		Scores [2]float64
+	}
+	type Outer struct {
+		Name  string
+		Inner *Inner
+		ByKey map[string][]Inner
+	}
+	ts := newTypeSchema(reflect.TypeOf(Outer{}), make(map[reflect.Type]bool))
+	typ, err := ts.Type()
+	_assert(err == nil, "type error: %v", err)
+	_assert(typ.String() == "struct { Name string; Inner *struct { Scores [2]float64 }; ByKey map[string][]struct { Scores [2]float64 } }",
+		"expect an unnamed type with the same structure, got %s", typ)
+	_assert(ts.Name == "geerpc.Outer" && ts.Fields[2].Type.String() == "map[string][]geerpc.Inner", "expect type names, got %s", ts.Fields[2].Type)
+
+	_, err = (&TypeSchema{Kind: "func"}).Type()
+	_assert(err != nil, "expect an error building a func type")
+}
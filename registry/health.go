@@ -0,0 +1,79 @@
+package registry
+
+import (
+	"context"
+	"geerpc"
+	"time"
+)
+
+// CheckHealth makes r call Health.Check on every registered server every interval, the servers which are not serving
+// are left out of the server list until they are serving again. opt is used to dial the servers, the returned
+// function stops checking.
+func (r *GeeRegistry) CheckHealth(interval time.Duration, opt *geerpc.Option) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		clients := make(map[string]*geerpc.Client)
+		defer func() {
+			for _, client := range clients {
+				_ = client.Close()
+			}
+		}()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			r.checkHealth(clients, interval, opt)
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// checkHealth checks every registered server, reusing the connections in clients
+func (r *GeeRegistry) checkHealth(clients map[string]*geerpc.Client, timeout time.Duration, opt *geerpc.Option) {
+	r.mu.Lock()
+	logger := r.logger
+	addrs := make([]string, 0, len(r.servers))
+	for addr := range r.servers {
+		addrs = append(addrs, addr)
+	}
+	r.mu.Unlock()
+
+	serving := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		client := clients[addr]
+		if client == nil || !client.IsAvailable() {
+			var err error
+			if client, err = geerpc.XDial(addr, opt); err != nil {
+				logger.Warn("rpc registry: health check dial error", "addr", addr, "err", err)
+				serving[addr] = false
+				continue
+			}
+			clients[addr] = client
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		status, err := client.CheckHealth(ctx, "")
+		cancel()
+		if status != geerpc.HealthServing {
+			logger.Warn("rpc registry: server not serving", "addr", addr, "status", status.String(), "err", err)
+		}
+		serving[addr] = status == geerpc.HealthServing
+	}
+	for addr, client := range clients {
+		if _, ok := serving[addr]; !ok { // the server has expired
+			_ = client.Close()
+			delete(clients, addr)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for addr, ok := range serving {
+		if s := r.servers[addr]; s != nil {
+			s.notServing = !ok
+		}
+	}
+}
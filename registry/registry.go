@@ -1,7 +1,8 @@
 package registry
 
 import (
-	"log"
+	"geerpc"
+	"log/slog"
 	"net/http"
 	"sort"
 	"strings"
@@ -15,33 +16,50 @@ const (
 )
 
 type ServerItem struct {
-	Addr  string
-	start time.Time
+	Addr       string
+	Weight     int // share of the calls relative to the other servers, see geerpc.ParseWeightedAddr
+	start      time.Time
+	notServing bool // set by the health check, see CheckHealth
 }
 
 type GeeRegistry struct {
 	timeout time.Duration
 	mu      sync.Mutex
 	servers map[string]*ServerItem
+	logger  *slog.Logger
 }
 
 func New(timeout time.Duration) *GeeRegistry {
 	return &GeeRegistry{
 		servers: make(map[string]*ServerItem),
 		timeout: timeout,
+		logger:  geerpc.DiscardLogger,
 	}
 }
 
+// SetLogger sets the logger of r, it is silent by default
+func (r *GeeRegistry) SetLogger(logger *slog.Logger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logger = logger
+}
+
+func (r *GeeRegistry) getLogger() *slog.Logger {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.logger
+}
+
 var DefaultGeeRegistry = New(defaultTimeout)
 
-func (r *GeeRegistry) putServer(addr string) {
+func (r *GeeRegistry) putServer(addr string, weight int) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	s := r.servers[addr]
 	if s == nil {
-		r.servers[addr] = &ServerItem{Addr: addr, start: time.Now()}
+		r.servers[addr] = &ServerItem{Addr: addr, Weight: weight, start: time.Now()}
 	} else {
-		s.start = time.Now()
+		s.start, s.Weight = time.Now(), weight
 	}
 }
 
@@ -51,7 +69,9 @@ func (r *GeeRegistry) aliveServers() []string {
 	var alive []string
 	for addr, s := range r.servers {
 		if r.timeout == 0 || s.start.Add(r.timeout).After(time.Now()) {
-			alive = append(alive, addr)
+			if !s.notServing {
+				alive = append(alive, geerpc.WeightedAddr(addr, s.Weight))
+			}
 		} else {
 			delete(r.servers, addr)
 		}
@@ -65,12 +85,12 @@ func (r *GeeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	case "GET":
 		w.Header().Set("X-Geerpc-Servers", strings.Join(r.aliveServers(), ","))
 	case "POST":
-		addr := req.Header.Get("X-Geerpc-Server")
-		if addr == "" {
+		addr, weight, err := geerpc.ParseWeightedAddr(req.Header.Get("X-Geerpc-Server"))
+		if addr == "" || err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		r.putServer(addr)
+		r.putServer(addr, weight)
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
@@ -78,36 +98,48 @@ func (r *GeeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 func (r *GeeRegistry) HandleHTPP(registryPath string) {
 	http.Handle(registryPath, r)
-	log.Println("rpc registry path:", registryPath)
+	r.getLogger().Info("rpc registry: path", "path", registryPath)
 }
 
 func HandleHTTP() {
 	DefaultGeeRegistry.HandleHTPP(defaultPath)
 }
 
-func sendHeartbeat(registry, addr string) error {
-	log.Println(addr, "send heart beat to registry", registry)
+func sendHeartbeat(registry, addr string, logger *slog.Logger) error {
+	logger.Debug("rpc registry: send heart beat", "addr", addr, "registry", registry)
 	httpClient := &http.Client{}
 	req, _ := http.NewRequest("POST", registry, nil)
 	req.Header.Set("X-Geerpc-Server", addr)
-	if _, err := httpClient.Do(req); err != nil {
-		log.Println("rpc server: heart beat err:", err)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		logger.Error("rpc registry: heart beat error", "addr", addr, "registry", registry, "err", err)
 		return err
 	}
+	_ = resp.Body.Close()
 	return nil
 }
 
+// Heartbeat registers addr to the registry every duration, addr can have a weight, e.g. tcp@10.0.0.1:9999;weight=3.
+// The heartbeats are not logged, see HeartbeatWithLogger.
 func Heartbeat(registry, addr string, duration time.Duration) {
+	HeartbeatWithLogger(registry, addr, duration, nil)
+}
+
+// HeartbeatWithLogger is like Heartbeat, but logs the heartbeats to logger, nil means silent.
+func HeartbeatWithLogger(registry, addr string, duration time.Duration, logger *slog.Logger) {
 	if duration == 0 {
 		duration = defaultTimeout - time.Duration(1)*time.Minute
 	}
+	if logger == nil {
+		logger = geerpc.DiscardLogger
+	}
 	var err error
-	err = sendHeartbeat(registry, addr)
+	err = sendHeartbeat(registry, addr, logger)
 	go func() {
 		t := time.NewTicker(duration)
 		for err == nil {
 			<-t.C
-			err = sendHeartbeat(registry, addr)
+			err = sendHeartbeat(registry, addr, logger)
 		}
 	}()
 }
@@ -0,0 +1,118 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// notSentError is the error of a call which never reached the server
+type notSentError struct {
+	err error
+}
+
+func (e *notSentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *notSentError) Unwrap() error {
+	return e.err
+}
+
+// NotSent marks err as the error of a call which provably never reached the server, e.g. a dial error.
+// A RetryPolicy retries such calls even if their method isn't idempotent.
+func NotSent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &notSentError{err: err}
+}
+
+// IsNotSent reports whether err is the error of a call which never reached the server,
+// marked by NotSent or ErrShutdown, which a client returns for calls made after it was closed.
+func IsNotSent(err error) bool {
+	var e *notSentError
+	return errors.As(err, &e) || errors.Is(err, ErrShutdown)
+}
+
+// RetryPolicy makes a failed call be made again, set it in Option.RetryPolicy.
+// Calls which never reached the server are always retried. Calls which did are retried only if their method is
+// idempotent and they failed with one of RetryableCodes, as they may have been handled already.
+type RetryPolicy struct {
+	MaxAttempts    int     // including the first one, 1 or less means no retry
+	Backoff        Backoff // wait between attempts, zero value means DefaultBackoff
+	RetryableCodes []Code  // nil means CodeUnavailable, which includes lost connections
+	// Idempotent holds the "Service.Method"s, or whole "Service"s, which may be handled more than once
+	Idempotent map[string]bool
+}
+
+func (p *RetryPolicy) idempotent(serviceMethod string) bool {
+	if p.Idempotent[serviceMethod] {
+		return true
+	}
+	for i := len(serviceMethod) - 1; i >= 0; i-- {
+		if serviceMethod[i] == '.' {
+			return p.Idempotent[serviceMethod[:i]]
+		}
+	}
+	return false
+}
+
+// retryable reports whether a call of serviceMethod which failed with err may be made again
+func (p *RetryPolicy) retryable(serviceMethod string, err error) bool {
+	if IsNotSent(err) {
+		return true
+	}
+	if !p.idempotent(serviceMethod) {
+		return false
+	}
+	code := CodeOf(err)
+	var e *Error
+	if !errors.As(err, &e) { // not from the server, the connection failed
+		code = CodeUnavailable
+	}
+	if p.RetryableCodes == nil {
+		return code == CodeUnavailable
+	}
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Do makes the call, and makes it again while it fails with a retryable error, up to MaxAttempts times.
+// It stops waiting when ctx is done. A nil policy makes the call once.
+func (p *RetryPolicy) Do(ctx context.Context, serviceMethod string, call func() error) error {
+	err := call()
+	if p == nil {
+		return err
+	}
+	backoff := p.Backoff
+	if backoff == (Backoff{}) {
+		backoff = DefaultBackoff
+	}
+	for attempt := 1; attempt < p.MaxAttempts && err != nil && p.retryable(serviceMethod, err); attempt++ {
+		t := time.NewTimer(backoff.Delay(attempt - 1))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("rpc client: call failed after %d attempts: %s, last error: %w", attempt, ctx.Err(), err)
+		case <-t.C:
+		}
+		err = call()
+	}
+	return err
+}
+
+// withoutRetry returns a copy of opt without RetryPolicy, for the clients wrapped by clients retrying themselves
+func (opt *Option) withoutRetry() *Option {
+	if opt.RetryPolicy == nil {
+		return opt
+	}
+	o := *opt
+	o.RetryPolicy = nil
+	return &o
+}
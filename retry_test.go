@@ -0,0 +1,92 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Flaky fails with Unavailable until it has been called Fails times
+type Flaky struct {
+	Fails int32
+	calls int32
+}
+
+func (f *Flaky) Get(_ int, reply *int32) error {
+	n := atomic.AddInt32(&f.calls, 1)
+	if n <= f.Fails {
+		return Errorf(CodeUnavailable, "call %d fails", n)
+	}
+	*reply = n
+	return nil
+}
+
+func (f *Flaky) Add(_ int, reply *int32) error {
+	return f.Get(0, reply)
+}
+
+func TestRetryPolicy_retryable(t *testing.T) {
+	p := &RetryPolicy{Idempotent: map[string]bool{"Flaky.Get": true, "Foo": true}}
+	unavailable := Errorf(CodeUnavailable, "down")
+	tests := []struct {
+		method string
+		err    error
+		expect bool
+	}{
+		{"Flaky.Get", unavailable, true},
+		{"Flaky.Get", Errorf(CodeInvalidArgument, "bad"), false},
+		{"Flaky.Get", io.ErrUnexpectedEOF, true}, // the connection is lost
+		{"Foo.Sum", unavailable, true},
+		{"Flaky.Add", unavailable, false},
+		{"Flaky.Add", NotSent(unavailable), true},
+		{"Flaky.Add", fmt.Errorf("wrapped: %w", ErrShutdown), true},
+	}
+	for _, tt := range tests {
+		_assert(p.retryable(tt.method, tt.err) == tt.expect, "%s %v: expect retryable %v", tt.method, tt.err, tt.expect)
+	}
+	p.RetryableCodes = []Code{CodeResourceExhausted}
+	_assert(!p.retryable("Flaky.Get", unavailable), "expect only the set codes to be retried")
+	_assert(p.retryable("Flaky.Get", Errorf(CodeResourceExhausted, "busy")), "expect the set codes to be retried")
+	_assert(CodeOf(NotSent(unavailable)) == CodeUnavailable, "expect NotSent to keep the code")
+}
+
+func TestClient_CallRetry(t *testing.T) {
+	flaky := &Flaky{Fails: 2}
+	addr := startTestServer(t, NewServer(), flaky)
+
+	policy := &RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     Backoff{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond * 10, Multiplier: 2},
+		Idempotent:  map[string]bool{"Flaky.Get": true},
+	}
+	client, err := Dial("tcp", addr, &Option{MagicNumber: MagicNumber, RetryPolicy: policy})
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	ctx := context.Background()
+	var reply int32
+	err = client.Call(ctx, "Flaky.Add", 0, &reply)
+	_assert(CodeOf(err) == CodeUnavailable && atomic.LoadInt32(&flaky.calls) == 1, "expect no retry of a non idempotent method, got %v", err)
+
+	atomic.StoreInt32(&flaky.calls, 0)
+	err = client.Call(ctx, "Flaky.Get", 0, &reply)
+	_assert(err == nil && reply == 3, "expect the third attempt to succeed, got %d %v", reply, err)
+
+	atomic.StoreInt32(&flaky.calls, 0)
+	flaky.Fails = 5
+	err = client.Call(ctx, "Flaky.Get", 0, &reply)
+	_assert(CodeOf(err) == CodeUnavailable && atomic.LoadInt32(&flaky.calls) == 3, "expect 3 attempts, got %v", err)
+
+	atomic.StoreInt32(&flaky.calls, 0)
+	policy.Backoff = Backoff{BaseDelay: time.Second, MaxDelay: time.Second}
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+	defer cancel()
+	err = client.Call(ctx, "Flaky.Get", 0, &reply)
+	var e *Error
+	_assert(errors.As(err, &e) && ctx.Err() != nil && atomic.LoadInt32(&flaky.calls) == 1,
+		"expect to stop waiting when ctx is done and keep the last error, got %v", err)
+}
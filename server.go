@@ -1,25 +1,30 @@
 package geerpc
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"geerpc/codec"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const MagicNumber = 0x3bef5c // magic number identifies rpc request
 
 const (
-	connected        = "200 Connected to Gee RPC"
-	defaultRPCPath   = "/_geerpc_"
-	defaultDebugPath = "/debug/geerpc"
+	connected          = "200 Connected to Gee RPC"
+	defaultRPCPath     = "/_geerpc_"
+	defaultDebugPath   = "/debug/geerpc"
+	defaultMetricsPath = "/metrics"
 )
 
 type Option struct {
@@ -27,6 +32,12 @@ type Option struct {
 	CodecType      codec.Type
 	ConnectTimeout time.Duration // 0 means no limit
 	HandleTimeout  time.Duration
+	TLSConfig      *tls.Config  `json:"-"` // used by XDial for "tls@" addresses, never sent to the server
+	Metadata       Metadata     // sent in the handshake, e.g. credentials checked once per connection by the server's Authenticator
+	Credentials    Credentials  `json:"-"` // adds authentication metadata to every call
+	Logger         *slog.Logger `json:"-"` // logger of the client, nil means DiscardLogger
+	SpanExporter   SpanExporter `json:"-"` // traces every Client.Call if set
+	RetryPolicy    *RetryPolicy `json:"-"` // retries failed calls if set
 }
 
 var DefaultOption = &Option{
@@ -36,39 +47,77 @@ var DefaultOption = &Option{
 }
 
 type Server struct {
-	serviceMap sync.Map // use sync.Map to store service name and its corresponding service
+	serviceMap sync.Map                // use sync.Map to store service name and its corresponding service
+	limiters   map[string]*rateLimiter // Service.Method -> rate limiter, read only after NewServer
+
+	authenticator Authenticator
+	policy        Policy
+	handleTimeout time.Duration // default handle timeout of every method, 0 means no limit
+	logger        *slog.Logger
+	stats         serverStats
+	spanExporter  SpanExporter
+	conns         sync.Map // *connState -> struct{}, connections being served
+	health        *healthService
+}
+
+// ServerOption configures a Server created by NewServer
+type ServerOption func(*Server)
+
+func NewServer(opts ...ServerOption) *Server {
+	s := &Server{limiters: make(map[string]*rateLimiter), logger: DiscardLogger}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.registerReflection()
+	s.registerHealth()
+	return s
 }
 
-func NewServer() *Server {
-	return &Server{}
+// WithHandleTimeout sets the default handle timeout of every method, the client can't raise it.
+// Register can override it for a service or method.
+func WithHandleTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.handleTimeout = timeout
+	}
+}
+
+func (s *Server) Register(rcvr interface{}, opts ...ServiceOption) error {
+	svc := newService(rcvr, s.logger) // create service
+	for _, opt := range opts {
+		if err := opt(svc); err != nil {
+			return err
+		}
+	}
+	return s.register(svc)
 }
 
-func (s *Server) Register(rcvr interface{}) error {
-	svc := newService(rcvr)                                     // create service
+func (s *Server) register(svc *service) error {
 	if _, dup := s.serviceMap.LoadOrStore(svc.name, svc); dup { // check if service is already registered
 		return fmt.Errorf("rpc server: service already defined: %s", svc.name)
 	}
 	return nil
 }
 
-func Register(rcvr interface{}) error { return DefaultServer.Register(rcvr) }
+func Register(rcvr interface{}, opts ...ServiceOption) error {
+	return DefaultServer.Register(rcvr, opts...)
+}
 
 func (s *Server) findService(serviceMethod string) (svc *service, mtype *methodType, err error) {
 	dot := strings.LastIndex(serviceMethod, ".") // find the last index of '.'
 	if dot < 0 {
-		err = fmt.Errorf("rpc server: service/method request ill-formed: %s", serviceMethod)
+		err = Errorf(CodeInvalidArgument, "rpc server: service/method request ill-formed: %s", serviceMethod)
 		return
 	}
 	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:] // get service name and method name
 	svci, ok := s.serviceMap.Load(serviceName)                            // get service from service map
 	if !ok {
-		err = fmt.Errorf("rpc server: can't find service %s", serviceName)
+		err = Errorf(CodeNotFound, "rpc server: can't find service %s", serviceName)
 		return
 	}
 	svc = svci.(*service) // type assertion
 	mtype = svc.method[methodName]
 	if mtype == nil {
-		err = fmt.Errorf("rpc server: can't find method %s", methodName)
+		err = Errorf(CodeNotFound, "rpc server: can't find method %s", methodName)
 	}
 	return
 }
@@ -78,35 +127,76 @@ func (s *Server) Accept(lis net.Listener) {
 	for {
 		conn, err := lis.Accept() // wait for a connection request
 		if err != nil {
-			log.Println("rpc server: accept error:", err)
+			s.logger.Error("rpc server: accept error", "err", err)
 			return
 		}
 		go s.ServerConn(conn)
 	}
 }
 
+// AcceptTLS is like Accept, but serves every connection over TLS using config.
+// Set config.ClientAuth to tls.RequireAndVerifyClientCert for mutual TLS,
+// the verified client identity is then available to service methods through PeerFromContext.
+func (s *Server) AcceptTLS(lis net.Listener, config *tls.Config) {
+	s.Accept(tls.NewListener(lis, config))
+}
+
 func (s *Server) ServerConn(conn net.Conn) {
 	defer func() { _ = conn.Close() }()
+	atomic.AddInt64(&s.stats.activeConns, 1)
+	defer atomic.AddInt64(&s.stats.activeConns, -1)
+	logger := s.logger.With("remote", conn.RemoteAddr().String())
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil { // complete the handshake to learn the peer identity
+			logger.Warn("rpc server: tls handshake error", "err", err)
+			return
+		}
+	}
+	ctx := context.WithValue(context.Background(), peerKey{}, newPeer(conn))
+	conn = &countingConn{Conn: conn, stats: &s.stats}
 	var opt Option
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil { // decode option
-		log.Println("rpc server: options error:", err)
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&opt); err != nil { // decode option
+		logger.Warn("rpc server: options error", "err", err)
 		return
 	}
 	if opt.MagicNumber != MagicNumber { // check magic number
-		log.Printf("rpc server: invalid magic number %x", opt.MagicNumber)
+		logger.Warn("rpc server: invalid magic number", "magic", fmt.Sprintf("%x", opt.MagicNumber))
 		return
 	}
 	f := codec.NewCodecFuncMap[opt.CodecType] // get corresponding codec constructor
 	if f == nil {
-		log.Printf("rpc server: invalid codec type %s", opt.CodecType)
+		logger.Warn("rpc server: invalid codec type", "codec", opt.CodecType)
 		return
 	}
-	s.serveCodec(f(conn), &opt) // serve requests using codec
+	ctx = s.authenticateConn(ctx, &opt)
+	cs := &connState{remote: conn.RemoteAddr().String(), codec: opt.CodecType, since: time.Now()}
+	s.conns.Store(cs, struct{}{})
+	defer s.conns.Delete(cs)
+	s.serveCodec(ctx, f(newBufferedConn(conn, dec.Buffered())), &opt, cs) // serve requests using codec
+}
+
+// bufferedConn replays the bytes the option decoder has read ahead before reading from conn
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func newBufferedConn(conn net.Conn, buffered io.Reader) *bufferedConn {
+	r := bufio.NewReader(io.MultiReader(buffered, conn))
+	if b, err := r.Peek(1); err == nil && b[0] == '\n' { // skip the newline written by json.Encoder
+		_, _ = r.Discard(1)
+	}
+	return &bufferedConn{Conn: conn, r: r}
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
 }
 
 var invalidRequest = struct{}{}
 
-func (s *Server) serveCodec(cc codec.Codec, opt *Option) {
+func (s *Server) serveCodec(ctx context.Context, cc codec.Codec, opt *Option, cs *connState) {
 	sending := new(sync.Mutex) // make sure to send a complete response
 	wg := new(sync.WaitGroup)  // wait until all request are handled
 	for {
@@ -115,12 +205,26 @@ func (s *Server) serveCodec(cc codec.Codec, opt *Option) {
 			if req == nil {
 				break // it's not possible to recover, so close the connection
 			}
-			req.h.Error = err.Error() // encode error message in response header
-			s.sendResponse(cc, req.h, invalidRequest, sending)
+			if req.mtype != nil {
+				req.mtype.stats.finish(err, -1)
+			}
+			s.sendError(cc, req.h, err, sending) // encode error message in response header
+			continue
+		}
+		req.ctx = context.WithValue(ctx, incomingMetadataKey{}, req.md)
+		req.conn = cs
+		if err = s.authorize(req); err != nil {
+			req.mtype.stats.finish(err, -1)
+			s.sendError(cc, req.h, err, sending)
+			continue
+		}
+		if err = s.checkRateLimit(req); err != nil {
+			req.mtype.stats.finish(err, -1)
+			s.sendError(cc, req.h, err, sending)
 			continue
 		}
 		wg.Add(1)
-		go s.handleRequest(cc, req, sending, wg, opt.HandleTimeout) // handle request
+		go s.handleRequest(cc, req, sending, wg, s.timeoutOf(req, opt.HandleTimeout)) // handle request
 	}
 	wg.Wait()
 	_ = cc.Close()
@@ -128,17 +232,20 @@ func (s *Server) serveCodec(cc codec.Codec, opt *Option) {
 
 // request stores all information of a call
 type request struct {
-	h            *codec.Header // header of request
-	argv, replyv reflect.Value // argv and replyv of request
-	mtype        *methodType   // method type of request
-	svc          *service      // service of request
+	h            *codec.Header   // header of request
+	argv, replyv reflect.Value   // argv and replyv of request
+	mtype        *methodType     // method type of request
+	svc          *service        // service of request
+	md           Metadata        // metadata sent along with the request
+	ctx          context.Context // carries the peer and metadata to service methods
+	conn         *connState      // connection the request was received on
 }
 
 func (s *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
 	var h codec.Header
 	if err := cc.ReadHeader(&h); err != nil { // read request header
 		if err != io.EOF && err != io.ErrUnexpectedEOF { // io.EOF means end of connection
-			log.Println("rpc server: read header error:", err)
+			s.logger.Warn("rpc server: read header error", "err", err)
 		}
 		return nil, err
 	}
@@ -150,9 +257,12 @@ func (s *Server) readRequest(cc codec.Codec) (*request, error) {
 	if err != nil {
 		return nil, err
 	}
-	req := &request{h: h}
+	req := &request{h: h, md: h.Metadata}
+	h.Metadata = nil // h is reused as the response header, don't echo metadata back
+
 	req.svc, req.mtype, err = s.findService(h.ServiceMethod) // find service and method type
 	if err != nil {
+		_ = cc.ReadBody(nil) // discard body, so that the next request can be read
 		return req, err
 	}
 	req.argv = req.mtype.newArgv()     // create argv
@@ -164,8 +274,8 @@ func (s *Server) readRequest(cc codec.Codec) (*request, error) {
 		argvi = req.argv.Addr().Interface()
 	}
 	if err = cc.ReadBody(argvi); err != nil { // read request body
-		log.Println("rpc server: read body error:", err)
-		return req, err
+		s.logger.Warn("rpc server: read body error", "seq", h.Seq, "method", h.ServiceMethod, "err", err)
+		return req, Errorf(CodeInvalidArgument, "rpc server: read body error: %s", err)
 	}
 	return req, nil
 }
@@ -174,39 +284,147 @@ func (s *Server) sendResponse(cc codec.Codec, h *codec.Header, body interface{},
 	sending.Lock() // make sure to send a complete response
 	defer sending.Unlock()
 	if err := cc.Write(h, body); err != nil { // encode and send response
-		log.Println("rpc server: write response error:", err)
+		s.logger.Error("rpc server: write response error", "seq", h.Seq, "method", h.ServiceMethod, "err", err)
+	}
+}
+
+// sendError sends a response carrying err and its code
+func (s *Server) sendError(cc codec.Codec, h *codec.Header, err error, sending *sync.Mutex) {
+	h.Error = err.Error()
+	h.Code = int(CodeOf(err))
+	s.sendResponse(cc, h, invalidRequest, sending)
+}
+
+// handleTimeoutError is sent when a request is not handled within timeout
+func handleTimeoutError(timeout time.Duration) error {
+	return Errorf(CodeDeadlineExceeded, "rpc server: request handle timeout: expect within %s", timeout)
+}
+
+// minTimeout returns the shorter of a and b, 0 means no limit
+func minTimeout(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// timeoutOf returns the handle timeout of req: the server policy, or the client's, whichever is shorter.
+// The server policy is the method's timeout, else its service's, else the server default.
+// The client's is the connection's HandleTimeout, or the deadline of the call if it is shorter.
+func (s *Server) timeoutOf(req *request, clientTimeout time.Duration) time.Duration {
+	timeout := req.mtype.timeout
+	if timeout == 0 {
+		timeout = req.svc.timeout
+	}
+	if timeout == 0 {
+		timeout = s.handleTimeout
+	}
+	timeout = minTimeout(timeout, clientTimeout)
+	if d, err := time.ParseDuration(req.md[timeoutKey]); err == nil && d > 0 {
+		timeout = minTimeout(timeout, d)
 	}
+	return timeout
+}
+
+// logRequest logs a handled request at debug level, or at warn level if the method failed
+func (s *Server) logRequest(req *request, d time.Duration, err error) {
+	level := slog.LevelDebug
+	if err != nil {
+		level = slog.LevelWarn
+	}
+	if !s.logger.Enabled(req.ctx, level) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.Uint64("seq", req.h.Seq),
+		slog.String("method", req.h.ServiceMethod),
+		slog.Duration("duration", d),
+	}
+	if p, ok := PeerFromContext(req.ctx); ok && p.Addr != nil {
+		attrs = append(attrs, slog.String("remote", p.Addr.String()))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("err", err))
+	}
+	s.logger.LogAttrs(req.ctx, level, "rpc server: handle request", attrs...)
+}
+
+// startSpan opens the server span of req if tracing is on, and puts the span context in req.ctx
+// so that calls made by the method join the trace
+func (s *Server) startSpan(req *request) *Span {
+	parent, ok := parseTraceparent(req.md[traceparentKey])
+	if s.spanExporter == nil {
+		if ok {
+			req.ctx = ContextWithSpan(req.ctx, parent)
+		}
+		return nil
+	}
+	var peer string
+	if p, found := PeerFromContext(req.ctx); found && p.Addr != nil {
+		peer = p.Addr.String()
+	}
+	span := startSpan(SpanKindServer, req.h.ServiceMethod, peer, parent, ok)
+	req.ctx = ContextWithSpan(req.ctx, span.context())
+	return span
 }
 
 func (s *Server) handleRequest(cc codec.Codec, req *request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) {
 	defer wg.Done()
-	called := make(chan struct{})
-	sent := make(chan struct{})
+	var responded int32 // the method and the timeout race to respond, only the first one sends
+	respond := func() bool { return atomic.CompareAndSwapInt32(&responded, 0, 1) }
+	stats := &req.mtype.stats
+	atomic.AddInt64(&stats.inFlight, 1)
+	start := time.Now()
+	span := s.startSpan(req)
+	finish := func(err error) { // record the response sent for req
+		stats.finish(err, time.Since(start))
+		if span != nil {
+			span.end(s.spanExporter, err)
+		}
+	}
+	done := make(chan struct{}) // closed once the method returned and its response, if any, is sent
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 { // let methods taking a context stop early
+		req.ctx, cancel = context.WithTimeout(req.ctx, timeout)
+	}
+	req.conn.inFlight.Store(req.h.Seq, &inFlightRequest{method: req.h.ServiceMethod, start: start})
 	go func() {
-		log.Println("rpc server: receive request:", req.h, req.argv)
-		err := req.svc.call(req.mtype, req.argv, req.replyv) // call service method
-		called <- struct{}{}
+		defer close(done)
+		defer cancel()
+		err := req.svc.call(req.ctx, req.mtype, req.argv, req.replyv) // call service method
+		atomic.AddInt64(&stats.inFlight, -1)
+		req.conn.inFlight.Delete(req.h.Seq)
+		if err != nil && CodeOf(err) == CodeUnknown && req.ctx.Err() == context.DeadlineExceeded {
+			err = handleTimeoutError(timeout) // the method gave up on the deadline the timer also owns
+		}
+		s.logRequest(req, time.Since(start), err)
+		if !respond() {
+			return // timed out, the client already got an error
+		}
 		if err != nil {
-			req.h.Error = err.Error()
-			s.sendResponse(cc, req.h, invalidRequest, sending)
-			sent <- struct{}{}
-			return
+			s.sendError(cc, req.h, err, sending)
+		} else {
+			s.sendResponse(cc, req.h, req.replyv.Interface(), sending)
 		}
-		s.sendResponse(cc, req.h, req.replyv.Interface(), sending)
-		sent <- struct{}{}
+		finish(err)
 	}()
 
 	if timeout == 0 {
-		<-called
-		<-sent
+		<-done
 		return
 	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 	select {
-	case <-time.After(timeout):
-		req.h.Error = fmt.Sprintf("rpc server: request handle timeout: expect within %s", timeout)
-		s.sendResponse(cc, req.h, invalidRequest, sending)
-	case <-called:
-		<-sent
+	case <-timer.C:
+		if !respond() {
+			<-done // the method returned just in time and is sending its response
+			return
+		}
+		err := handleTimeoutError(timeout)
+		s.sendError(cc, req.h, err, sending)
+		finish(err)
+	case <-done:
 	}
 }
 
@@ -219,7 +437,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	conn, _, err := w.(http.Hijacker).Hijack() // get underlying TCP connection
 	if err != nil {
-		log.Println("rpc hijacking", r.RemoteAddr, ":", err)
+		s.logger.Error("rpc server: hijacking error", "remote", r.RemoteAddr, "err", err)
 		return
 	}
 	_, _ = io.WriteString(conn, "HTTP/1.0 "+connected+"\n\n") // send response
@@ -228,14 +446,23 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) HandleHTTP() {
 	http.Handle(defaultRPCPath, s)
-	http.Handle(defaultDebugPath, debugHTTP{s}) // use debugHTTP to handle debug path
-	log.Println("rpc server debug path:", defaultDebugPath)
+	http.Handle(defaultDebugPath, debugHTTP{s})         // use debugHTTP to handle debug path
+	http.Handle(defaultMetricsPath, s.MetricsHandler()) // Prometheus metrics
+	s.logger.Info("rpc server: debug path", "path", defaultDebugPath, "metrics", defaultMetricsPath)
+}
+
+// MetricsHandler returns a handler serving the metrics of the server in the Prometheus text format,
+// HandleHTTP registers it on /metrics
+func (s *Server) MetricsHandler() http.Handler {
+	return metricsHTTP{s}
 }
 
 var DefaultServer = NewServer()
 
 func Accept(lis net.Listener) { DefaultServer.Accept(lis) }
 
+func AcceptTLS(lis net.Listener, config *tls.Config) { DefaultServer.AcceptTLS(lis, config) }
+
 func HandleHTTP() {
 	DefaultServer.HandleHTTP()
 }
@@ -0,0 +1,78 @@
+package geerpc
+
+import (
+	"encoding/json"
+	"geerpc/codec"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// countGoroutines waits for the number of goroutines to drop to at most n, and returns the last count
+func countGoroutines(n int, wait time.Duration) int {
+	deadline := time.Now().Add(wait)
+	for {
+		got := runtime.NumGoroutine()
+		if got <= n || time.Now().After(deadline) {
+			return got
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestServer_HandleTimeoutStress(t *testing.T) {
+	const calls = 2000
+	before := runtime.NumGoroutine()
+
+	s := NewServer(WithHandleTimeout(time.Millisecond))
+	var slow Slow
+	_ = s.Register(&slow)
+	l, _ := net.Listen("tcp", ":0")
+	go s.Accept(l)
+
+	// talk to the server through a raw codec, so that every response on the wire is seen
+	conn, err := net.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	_ = json.NewEncoder(conn).Encode(DefaultOption)
+	cc := codec.NewGobCodec(conn)
+	go func() {
+		for i := 1; i <= calls; i++ {
+			_ = cc.Write(&codec.Header{ServiceMethod: "Slow.Sleep", Seq: uint64(i)}, 20)
+		}
+	}()
+
+	responses := make(map[uint64]int)
+	for {
+		// handlers sleep 20ms, nothing arrives after the read deadline once all of them finished
+		_ = conn.SetReadDeadline(time.Now().Add(time.Millisecond * 500))
+		var h codec.Header
+		if err := cc.ReadHeader(&h); err != nil {
+			break
+		}
+		_ = cc.ReadBody(nil)
+		responses[h.Seq]++
+		// under load the timer may fire after the method returned, then the method responds
+		_assert(h.Code == int(CodeDeadlineExceeded) || h.Error == "", "expect DeadlineExceeded or a reply for seq %d, got %q", h.Seq, h.Error)
+	}
+	_assert(len(responses) == calls, "expect a response for each of %d calls, got %d", calls, len(responses))
+	for seq, n := range responses {
+		_assert(n == 1, "expect exactly one response for seq %d, got %d", seq, n)
+	}
+
+	_ = cc.Close()
+	_ = l.Close()
+	got := countGoroutines(before, time.Second*2)
+	_assert(got <= before, "expect handler goroutines to exit, %d before and %d after", before, got)
+}
+
+func TestServer_RegisterWithServiceName(t *testing.T) {
+	s := NewServer()
+	var foo Foo
+	_assert(s.Register(&foo, WithServiceName("Calc")) == nil, "expect register under another name")
+	_, _, err := s.findService("Calc.Sum")
+	_assert(err == nil, "expect Calc.Sum, got %v", err)
+	_, _, err = s.findService("Foo.Sum")
+	_assert(CodeOf(err) == CodeNotFound, "expect no Foo service, got %v", err)
+	_assert(s.Register(&foo, WithServiceName("a.b")) != nil, "expect an error for a name with a dot")
+}
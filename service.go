@@ -1,23 +1,35 @@
 package geerpc
 
 import (
+	"context"
+	"fmt"
 	"go/ast"
-	"log"
+	"log/slog"
 	"reflect"
+	"strings"
 	"sync/atomic"
+	"time"
 )
 
 type methodType struct {
-	method    reflect.Method
-	ArgType   reflect.Type
-	ReplyType reflect.Type
-	numCalls  uint64 // count method call
+	method      reflect.Method
+	ArgType     reflect.Type
+	ReplyType   reflect.Type
+	withContext bool          // method takes a context.Context as its first argument
+	timeout     time.Duration // handle timeout set at registration, 0 means the service's
+	numCalls    uint64        // count method call
+	numRejected uint64        // count calls rejected by rate limit
+	stats       methodStats
 }
 
 func (m *methodType) NumCalls() uint64 {
 	return atomic.LoadUint64(&m.numCalls) // atomic load
 }
 
+func (m *methodType) NumRejected() uint64 {
+	return atomic.LoadUint64(&m.numRejected)
+}
+
 func (m *methodType) newArgv() reflect.Value {
 	var argv reflect.Value
 	if m.ArgType.Kind() == reflect.Ptr { // if arg is pointer
@@ -40,59 +52,109 @@ func (m *methodType) newReplyv() reflect.Value {
 }
 
 type service struct {
-	name   string
-	typ    reflect.Type
-	rcvr   reflect.Value          // save receiver of methods
-	method map[string]*methodType // save methods of this service
+	name    string
+	typ     reflect.Type
+	rcvr    reflect.Value          // save receiver of methods
+	method  map[string]*methodType // save methods of this service
+	timeout time.Duration          // handle timeout of all methods set at registration, 0 means the server's
+}
+
+// ServiceOption configures a service at registration, see Server.Register
+type ServiceOption func(*service) error
+
+// WithServiceName registers the service under name instead of the name of its type
+func WithServiceName(name string) ServiceOption {
+	return func(s *service) error {
+		if name == "" || strings.Contains(name, ".") {
+			return fmt.Errorf("rpc server: invalid service name %q", name)
+		}
+		s.name = name
+		return nil
+	}
+}
+
+// WithServiceTimeout sets the handle timeout of every method of the service
+func WithServiceTimeout(timeout time.Duration) ServiceOption {
+	return func(s *service) error {
+		s.timeout = timeout
+		return nil
+	}
+}
+
+// WithMethodTimeout sets the handle timeout of one method of the service
+func WithMethodTimeout(method string, timeout time.Duration) ServiceOption {
+	return func(s *service) error {
+		m := s.method[method]
+		if m == nil {
+			return fmt.Errorf("rpc server: can't find method %s of service %s", method, s.name)
+		}
+		m.timeout = timeout
+		return nil
+	}
 }
 
-func newService(rcvr interface{}) *service {
+func newService(rcvr interface{}, logger *slog.Logger) *service {
 	s := new(service)
 	s.rcvr = reflect.ValueOf(rcvr) // get receiver of methods
 	s.name = reflect.Indirect(s.rcvr).Type().Name()
 	s.typ = reflect.TypeOf(rcvr)
-	log.Printf("rpc service: new service %s; type: %s\n", s.name, s.typ.String())
-	s.registerMethods()
+	logger = logger.With("service", s.name)
+	logger.Debug("rpc service: new service", "type", s.typ.String())
+	s.registerMethods(logger)
 	return s
 }
 
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
 func isExportedOrBuiltinType(t reflect.Type) bool {
 	return ast.IsExported(t.Name()) || t.PkgPath() == "" // check if type is exported or builtin
 }
 
-func (s *service) registerMethods() {
+func (s *service) registerMethods(logger *slog.Logger) {
 	s.method = make(map[string]*methodType)
-	log.Printf("rpc service: register %s\n", s.name)
 	for i := 0; i < s.typ.NumMethod(); i++ { // iterate all methods of this service
-		log.Printf("rpc service: register %s.%s\n", s.name, s.typ.Method(i).Name)
 		method := s.typ.Method(i)
 		mType := method.Type
-		if mType.NumIn() != 3 || mType.NumOut() != 1 { // check method signature: (receiver, *args, *reply) error
-			log.Printf("method %s has wrong number of ins or outs: %d, %d\n", method.Name, mType.NumIn(), mType.NumOut())
+		// check method signature: (receiver, [ctx,] *args, *reply) error
+		withContext := mType.NumIn() == 4 && mType.In(1) == typeOfContext
+		if (mType.NumIn() != 3 && !withContext) || mType.NumOut() != 1 {
+			logger.Debug("rpc service: method has wrong number of ins or outs", "method", method.Name, "ins", mType.NumIn(), "outs", mType.NumOut())
 			continue
 		}
-		if mType.Out(0) != reflect.TypeOf((*error)(nil)).Elem() { // check return type
-			log.Printf("method %s returns %s, not error\n", method.Name, mType.Out(0))
+		if mType.Out(0) != typeOfError { // check return type
+			logger.Debug("rpc service: method doesn't return error", "method", method.Name, "returns", mType.Out(0).String())
 			continue
 		}
-		argType, replyType := mType.In(1), mType.In(2) // check arg type and reply type
+		first := 1
+		if withContext {
+			first = 2
+		}
+		argType, replyType := mType.In(first), mType.In(first+1) // check arg type and reply type
 		if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType) {
-			log.Printf("method %s argument or reply type not exported: %v %v\n", method.Name, argType, replyType)
+			logger.Debug("rpc service: method argument or reply type not exported", "method", method.Name, "arg", argType.String(), "reply", replyType.String())
 			continue
 		}
 		s.method[method.Name] = &methodType{ // register method
-			method:    method,
-			ArgType:   argType,
-			ReplyType: replyType,
+			method:      method,
+			ArgType:     argType,
+			ReplyType:   replyType,
+			withContext: withContext,
 		}
-		log.Printf("rpc service: register %s.%s\n", s.name, method.Name)
+		logger.Debug("rpc service: register method", "method", method.Name)
 	}
 }
 
-func (s *service) call(m *methodType, argv, replyv reflect.Value) error {
+func (s *service) call(ctx context.Context, m *methodType, argv, replyv reflect.Value) error {
 	atomic.AddUint64(&m.numCalls, 1) // count method call by 1
 	f := m.method.Func
-	returnValues := f.Call([]reflect.Value{s.rcvr, argv, replyv}) // call method
+	in := []reflect.Value{s.rcvr, argv, replyv}
+	if m.withContext {
+		in = []reflect.Value{s.rcvr, reflect.ValueOf(ctx), argv, replyv}
+	}
+	returnValues := f.Call(in)                                    // call method
 	if errInter := returnValues[0].Interface(); errInter != nil { // get error
 		return errInter.(error)
 	}
@@ -1,7 +1,9 @@
 package geerpc
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"reflect"
 	"testing"
 )
@@ -26,9 +28,30 @@ func _assert(condition bool, msg string, v ...interface{}) {
 	}
 }
 
+// startTestServer registers rcvrs to s and serves it on a random port until the test ends, it returns the address
+func startTestServer(tb testing.TB, s *Server, rcvrs ...interface{}) string {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		tb.Fatal("network error:", err)
+	}
+	serveTest(tb, s, l, rcvrs...)
+	return l.Addr().String()
+}
+
+// serveTest registers rcvrs to s and serves it on l until the test ends
+func serveTest(tb testing.TB, s *Server, l net.Listener, rcvrs ...interface{}) {
+	for _, rcvr := range rcvrs {
+		if err := s.Register(rcvr); err != nil {
+			tb.Fatal("register error:", err)
+		}
+	}
+	go s.Accept(l)
+	tb.Cleanup(func() { _ = l.Close() })
+}
+
 func TestNewService(t *testing.T) {
 	var foo Foo
-	s := newService(&foo)
+	s := newService(&foo, DiscardLogger)
 	_assert(s != nil, "service is nil")
 	_assert(len(s.method) == 1, "wrong methods len, expect 1, but got %d", len(s.method))
 	mType := s.method["Sum"]
@@ -39,12 +62,12 @@ func TestNewService(t *testing.T) {
 
 func TestMethodType_Call(t *testing.T) {
 	var foo Foo
-	s := newService(&foo)
+	s := newService(&foo, DiscardLogger)
 	mType := s.method["Sum"]
 
 	argv := mType.newArgv()
 	replyv := mType.newReplyv()
 	argv.Set(reflect.ValueOf(Args{Num1: 1, Num2: 2}))
-	err := s.call(mType, argv, replyv)
+	err := s.call(context.Background(), mType, argv, replyv)
 	_assert(err == nil && *replyv.Interface().(*int) == 3 && mType.NumCalls() == 1, "failed to call Foo.Sum")
 }
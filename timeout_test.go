@@ -0,0 +1,79 @@
+package geerpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type Slow int
+
+func (s Slow) Sleep(ms int, reply *int) error {
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+	*reply = ms
+	return nil
+}
+
+func (s Slow) Wait(ctx context.Context, _ int, reply *time.Duration) error {
+	deadline, _ := ctx.Deadline()
+	*reply = time.Until(deadline)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestServer_timeoutOf(t *testing.T) {
+	s := NewServer(WithHandleTimeout(time.Second))
+	var slow Slow
+	_ = s.Register(&slow, WithMethodTimeout("Wait", time.Minute))
+	svc, sleep, _ := s.findService("Slow.Sleep")
+	_, wait, _ := s.findService("Slow.Wait")
+
+	req := &request{svc: svc, mtype: sleep}
+	_assert(s.timeoutOf(req, 0) == time.Second, "expect server default when client sends 0")
+	_assert(s.timeoutOf(req, time.Hour) == time.Second, "expect client not to raise the server timeout")
+	_assert(s.timeoutOf(req, time.Millisecond) == time.Millisecond, "expect shorter client timeout to win")
+	req.md = Metadata{timeoutKey: "10ms"}
+	_assert(s.timeoutOf(req, time.Millisecond*50) == time.Millisecond*10, "expect call deadline to win")
+
+	svc.timeout = time.Second * 2
+	_assert(s.timeoutOf(&request{svc: svc, mtype: sleep}, 0) == time.Second*2, "expect service timeout to override server default")
+	_assert(s.timeoutOf(&request{svc: svc, mtype: wait}, 0) == time.Minute, "expect method timeout to override service timeout")
+
+	err := s.Register(new(Foo), WithMethodTimeout("Missing", time.Second))
+	_assert(err != nil, "expect error for timeout of unknown method")
+}
+
+func TestServer_HandleTimeout(t *testing.T) {
+	addr := startTestServer(t, NewServer(WithHandleTimeout(time.Millisecond*100)), new(Slow))
+
+	client, err := Dial("tcp", addr) // DefaultOption has no HandleTimeout
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	err = client.Call(context.Background(), "Slow.Sleep", 500, &reply)
+	_assert(CodeOf(err) == CodeDeadlineExceeded, "expect DeadlineExceeded, got %v", err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var left time.Duration
+	start := time.Now()
+	err = client.Call(ctx, "Slow.Wait", 0, &left)
+	_assert(CodeOf(err) == CodeDeadlineExceeded && time.Since(start) < time.Millisecond*500,
+		"expect method context to be done within server timeout, got %v after %s", err, time.Since(start))
+}
+
+func TestServer_MethodDeadlineExceeded(t *testing.T) {
+	addr := startTestServer(t, NewServer(WithHandleTimeout(time.Millisecond*5)), new(Slow))
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	// Slow.Wait returns the error of its context, which expires together with the server timer,
+	// whichever of them responds the client sees DeadlineExceeded
+	for i := 0; i < 50; i++ {
+		var left time.Duration
+		err = client.Call(context.Background(), "Slow.Wait", 0, &left)
+		_assert(CodeOf(err) == CodeDeadlineExceeded, "expect DeadlineExceeded, got %v (%s)", err, CodeOf(err))
+	}
+}
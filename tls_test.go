@@ -0,0 +1,111 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+type Who int
+
+func (w Who) Identity(ctx context.Context, _ int, reply *string) error {
+	p, ok := PeerFromContext(ctx)
+	if !ok {
+		return Errorf(CodeInternal, "no peer in context")
+	}
+	*reply = p.Identity
+	return nil
+}
+
+// testCA issues certificates signed by a self-signed CA
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "geerpc test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+func (ca *testCA) issue(t *testing.T, cn string, usage x509.ExtKeyUsage) tls.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestDialTLS(t *testing.T) {
+	ca := newTestCA(t)
+	server := NewServer()
+	var w Who
+	_ = server.Register(&w)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.AcceptTLS(l, &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "server", x509.ExtKeyUsageServerAuth)},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	})
+	addr := l.Addr().String()
+
+	t.Run("tls", func(t *testing.T) {
+		client, err := DialTLS("tcp", addr, &tls.Config{RootCAs: ca.pool})
+		_assert(err == nil, "dial tls error: %v", err)
+		defer func() { _ = client.Close() }()
+		var reply string
+		err = client.Call(context.Background(), "Who.Identity", 0, &reply)
+		_assert(err == nil && reply == "", "expect no identity without client certificate, got %q %v", reply, err)
+	})
+	t.Run("mutual tls", func(t *testing.T) {
+		config := &tls.Config{
+			RootCAs:      ca.pool,
+			Certificates: []tls.Certificate{ca.issue(t, "alice", x509.ExtKeyUsageClientAuth)},
+		}
+		client, err := XDial("tls@"+addr, &Option{MagicNumber: MagicNumber, TLSConfig: config})
+		_assert(err == nil, "xdial tls error: %v", err)
+		defer func() { _ = client.Close() }()
+		var reply string
+		err = client.Call(context.Background(), "Who.Identity", 0, &reply)
+		_assert(err == nil && reply == "alice", "expect identity alice, got %q %v", reply, err)
+	})
+	t.Run("untrusted server", func(t *testing.T) {
+		_, err := DialTLS("tcp", addr, nil)
+		_assert(err != nil, "expect certificate verification error")
+	})
+}
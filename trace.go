@@ -0,0 +1,190 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// traceparentKey carries the span context of a call in the W3C Trace Context format
+const traceparentKey = "traceparent"
+
+// SpanContext identifies a span within a trace
+type SpanContext struct {
+	TraceID string // 32 lowercase hex digits
+	SpanID  string // 16 lowercase hex digits
+}
+
+// traceparent formats sc as a W3C traceparent header value, always sampled
+func (sc SpanContext) traceparent() string {
+	return "00-" + sc.TraceID + "-" + sc.SpanID + "-01"
+}
+
+// parseTraceparent parses a W3C traceparent header value of version 00
+func parseTraceparent(v string) (SpanContext, bool) {
+	parts := strings.Split(v, "-")
+	if len(parts) != 4 || parts[0] != "00" || !isHexID(parts[1], 32) || !isHexID(parts[2], 16) || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	return SpanContext{TraceID: parts[1], SpanID: parts[2]}, true
+}
+
+// isHexID reports whether s is n lowercase hex digits and not all zeros, which is an invalid id
+func isHexID(s string, n int) bool {
+	if len(s) != n || strings.Trim(s, "0") == "" {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type spanKey struct{}
+
+// SpanFromContext returns the span context of the span in ctx. Service methods taking a context
+// can pass it to Client.Call, so that their calls join the trace of the request.
+func SpanFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanKey{}).(SpanContext)
+	return sc, ok
+}
+
+// ContextWithSpan returns a copy of ctx carrying sc, calls made with it become children of sc
+func ContextWithSpan(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey{}, sc)
+}
+
+type SpanKind string
+
+const (
+	SpanKindClient SpanKind = "client"
+	SpanKindServer SpanKind = "server"
+)
+
+// Span is a finished client call or server request
+type Span struct {
+	TraceID  string        `json:"trace_id"`
+	SpanID   string        `json:"span_id"`
+	ParentID string        `json:"parent_id,omitempty"`
+	Kind     SpanKind      `json:"kind"`
+	Method   string        `json:"method"`
+	Peer     string        `json:"peer,omitempty"`
+	Code     Code          `json:"code"`
+	Status   string        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+}
+
+// SpanExporter receives every finished span, it must be safe for concurrent use
+type SpanExporter interface {
+	ExportSpan(span *Span)
+}
+
+// WithSpanExporter makes the server open a span for every request and export it once the request is done
+func WithSpanExporter(e SpanExporter) ServerOption {
+	return func(s *Server) {
+		s.spanExporter = e
+	}
+}
+
+// startSpan opens a span as a child of the span context parent, if ok
+func startSpan(kind SpanKind, method, peer string, parent SpanContext, ok bool) *Span {
+	span := &Span{
+		TraceID: parent.TraceID,
+		SpanID:  randomHex(8),
+		Kind:    kind,
+		Method:  method,
+		Peer:    peer,
+		Start:   time.Now(),
+	}
+	if ok {
+		span.ParentID = parent.SpanID
+	} else {
+		span.TraceID = randomHex(16)
+	}
+	return span
+}
+
+func (span *Span) context() SpanContext {
+	return SpanContext{TraceID: span.TraceID, SpanID: span.SpanID}
+}
+
+// end closes the span with the result err and exports it
+func (span *Span) end(e SpanExporter, err error) {
+	span.Duration = time.Since(span.Start)
+	span.Code = CodeOf(err)
+	span.Status = span.Code.String()
+	if err != nil {
+		span.Error = err.Error()
+	}
+	e.ExportSpan(span)
+}
+
+// InMemoryExporter keeps the exported spans in memory, it is meant for tests
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []Span
+}
+
+func (e *InMemoryExporter) ExportSpan(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, *span)
+}
+
+// Spans returns a copy of the exported spans, in export order
+func (e *InMemoryExporter) Spans() []Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	spans := make([]Span, len(e.spans))
+	copy(spans, e.spans)
+	return spans
+}
+
+// Reset drops the exported spans
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// JSONLinesExporter writes every span as one line of JSON, e.g. to a file
+type JSONLinesExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+func NewJSONLinesExporter(w io.Writer) *JSONLinesExporter {
+	return &JSONLinesExporter{enc: json.NewEncoder(w)}
+}
+
+func (e *JSONLinesExporter) ExportSpan(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.enc.Encode(span); err != nil && e.err == nil {
+		e.err = fmt.Errorf("rpc trace: export span error: %w", err)
+	}
+}
+
+// Err returns the first error writing a span, if any
+func (e *JSONLinesExporter) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
@@ -0,0 +1,66 @@
+package geerpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	sc, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_assert(ok && sc.TraceID == "4bf92f3577b34da6a3ce929d0e0e4736" && sc.SpanID == "00f067aa0ba902b7", "expect valid traceparent")
+	_assert(sc.traceparent() == "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "expect traceparent round trip")
+	for _, v := range []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+	} {
+		_, ok := parseTraceparent(v)
+		_assert(!ok, "expect %q to be invalid", v)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	serverSpans := new(InMemoryExporter)
+	addr := startTestServer(t, NewServer(WithSpanExporter(serverSpans)), new(Foo))
+
+	var out bytes.Buffer
+	clientSpans := NewJSONLinesExporter(&out)
+	client, err := Dial("tcp", addr, &Option{MagicNumber: MagicNumber, SpanExporter: clientSpans})
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	parent := SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	var reply int
+	err = client.Call(ContextWithSpan(context.Background(), parent), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil, "call error: %v", err)
+	_ = client.Call(context.Background(), "Foo.Missing", Args{}, &reply)
+
+	dec := json.NewDecoder(&out)
+	var clientSpan Span
+	_ = dec.Decode(&clientSpan)
+	_assert(clientSpans.Err() == nil, "export error: %v", clientSpans.Err())
+	_assert(clientSpan.Kind == SpanKindClient && clientSpan.TraceID == parent.TraceID && clientSpan.ParentID == parent.SpanID,
+		"expect client span to be a child of the span in ctx, got %+v", clientSpan)
+	_assert(clientSpan.Method == "Foo.Sum" && clientSpan.Status == "OK" && clientSpan.Peer != "", "expect method, status and peer, got %+v", clientSpan)
+
+	spans := serverSpans.Spans()
+	for i := 0; i < 100 && len(spans) == 0; i++ { // the server exports its span after sending the response
+		time.Sleep(time.Millisecond * 10)
+		spans = serverSpans.Spans()
+	}
+	_assert(len(spans) == 1, "expect one server span, got %d", len(spans))
+	_assert(spans[0].Kind == SpanKindServer && spans[0].TraceID == parent.TraceID && spans[0].ParentID == clientSpan.SpanID,
+		"expect server span to be a child of the client span, got %+v", spans[0])
+	_assert(spans[0].Peer != "" && spans[0].Duration > 0, "expect peer and timing, got %+v", spans[0])
+
+	var failed Span
+	_ = dec.Decode(&failed)
+	_assert(failed.Code == CodeNotFound && failed.Error != "" && failed.ParentID == "" && failed.TraceID != parent.TraceID,
+		"expect a new trace with an error status, got %+v", failed)
+}
@@ -0,0 +1,393 @@
+package xclient
+
+import (
+	"fmt"
+	. "geerpc"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ServerInfo is a server given to a Balancer
+type ServerInfo struct {
+	Addr   string // address accepted by XDial
+	Weight int    // at least 1
+}
+
+// PickInfo describes the call a Balancer picks a server for
+type PickInfo struct {
+	ServiceMethod string
+	Key           string   // key of XClient.CallWithKey
+	HasKey        bool     // the call was made with XClient.CallWithKey
+	Metadata      Metadata // outgoing metadata of the context of the call
+	// Pending returns the number of calls waiting for a reply from a server, it is nil when unknown, e.g. in SelectingDiscovery.Get
+	Pending func(rpcAddr string) int
+}
+
+// DoneInfo is the outcome of a call sent to a picked server
+type DoneInfo struct {
+	Err     error
+	Latency time.Duration
+	// Failed is set if the server failed the call, errors about the request, like CodeInvalidArgument, aren't failures
+	Failed bool
+	// Canceled is set if the outcome tells nothing about the server: the caller gave up the call, e.g. a losing hedge,
+	// or the server was picked but not called
+	Canceled bool
+}
+
+// Balancer picks the server of every call among the servers of a Discovery, its methods may be called concurrently.
+// Balancers are registered by name with RegisterBalancer, the built-in ones under the names of the select modes.
+type Balancer interface {
+	// Update replaces the servers to pick from. XClient calls it whenever the serving servers change, never with none.
+	Update(servers []ServerInfo)
+	// Pick picks the server of a call. The done func, if not nil, is called once with the outcome of the call.
+	Pick(info PickInfo) (rpcAddr string, done func(DoneInfo), err error)
+}
+
+func (m SelectMode) String() string {
+	switch m {
+	case RandomSelect:
+		return "random"
+	case RoundRobinSelect:
+		return "round_robin"
+	case ConsistentHashSelect:
+		return "consistent_hash"
+	case WeightedRoundRobinSelect:
+		return "weighted_round_robin"
+	case WeightedRandomSelect:
+		return "weighted_random"
+	case LeastPendingSelect:
+		return "least_pending"
+	case P2CSelect:
+		return "p2c"
+	default:
+		return fmt.Sprintf("SelectMode(%d)", int(m))
+	}
+}
+
+var (
+	balancersMu sync.RWMutex
+	balancers   = map[string]func() Balancer{
+		RandomSelect.String():             func() Balancer { return new(randomBalancer) },
+		RoundRobinSelect.String():         newRoundRobinBalancer,
+		ConsistentHashSelect.String():     newConsistentHashBalancer,
+		WeightedRoundRobinSelect.String(): func() Balancer { return new(weightedRoundRobinBalancer) },
+		WeightedRandomSelect.String():     func() Balancer { return new(weightedRandomBalancer) },
+		LeastPendingSelect.String():       func() Balancer { return new(leastPendingBalancer) },
+		P2CSelect.String():                func() Balancer { return new(p2cBalancer) },
+	}
+)
+
+// RegisterBalancer registers newBalancer under name for NewBalancer and XClient.UseBalancer.
+// Registering a built-in name, e.g. "round_robin", replaces the balancer of that select mode.
+func RegisterBalancer(name string, newBalancer func() Balancer) {
+	balancersMu.Lock()
+	defer balancersMu.Unlock()
+	balancers[name] = newBalancer
+}
+
+// NewBalancer returns a new Balancer of the kind registered under name
+func NewBalancer(name string) (Balancer, error) {
+	balancersMu.RLock()
+	newBalancer, ok := balancers[name]
+	balancersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("rpc balancer: unknown balancer %q", name)
+	}
+	return newBalancer(), nil
+}
+
+// serverList is the server list of the built-in balancers, its Update implements Balancer.Update
+type serverList struct {
+	mu      sync.Mutex
+	r       *rand.Rand
+	servers []ServerInfo
+	total   int // sum of weights
+}
+
+func (l *serverList) Update(servers []ServerInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.set(servers)
+}
+
+// set replaces the servers, weights below 1 are 1. l.mu must be held.
+func (l *serverList) set(servers []ServerInfo) {
+	l.servers = append(l.servers[:0:0], servers...)
+	l.total = 0
+	for i := range l.servers {
+		if l.servers[i].Weight < 1 {
+			l.servers[i].Weight = 1
+		}
+		l.total += l.servers[i].Weight
+	}
+}
+
+// intn returns a random number in [0, n), l.mu must be held
+func (l *serverList) intn(n int) int {
+	if l.r == nil {
+		l.r = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return l.r.Intn(n)
+}
+
+// random returns a random server, l.mu must be held
+func (l *serverList) random() (string, func(DoneInfo), error) {
+	if len(l.servers) == 0 {
+		return "", nil, fmt.Errorf("rpc balancer: no available servers")
+	}
+	return l.servers[l.intn(len(l.servers))].Addr, nil, nil
+}
+
+// randomBalancer is RandomSelect
+type randomBalancer struct {
+	serverList
+}
+
+func (b *randomBalancer) Pick(PickInfo) (string, func(DoneInfo), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.random()
+}
+
+// roundRobinBalancer is RoundRobinSelect
+type roundRobinBalancer struct {
+	serverList
+	index int // record the selected position
+}
+
+func newRoundRobinBalancer() Balancer {
+	b := new(roundRobinBalancer)
+	b.index = b.intn(math.MaxInt32 - 1) // initialize index
+	return b
+}
+
+func (b *roundRobinBalancer) Pick(PickInfo) (string, func(DoneInfo), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(b.servers)
+	if n == 0 {
+		return "", nil, fmt.Errorf("rpc balancer: no available servers")
+	}
+	s := b.servers[b.index%n] // servers could be updated, take the remainder
+	b.index = (b.index + 1) % n
+	return s.Addr, nil, nil
+}
+
+// weightedRoundRobinBalancer is WeightedRoundRobinSelect
+type weightedRoundRobinBalancer struct {
+	serverList
+	current map[string]int // current weight of every server
+}
+
+// Update replaces the servers, the ones kept keep their current weight
+func (b *weightedRoundRobinBalancer) Update(servers []ServerInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.set(servers)
+	current := make(map[string]int, len(servers))
+	for _, s := range servers {
+		current[s.Addr] = b.current[s.Addr]
+	}
+	b.current = current
+}
+
+func (b *weightedRoundRobinBalancer) Pick(PickInfo) (string, func(DoneInfo), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.servers) == 0 {
+		return "", nil, fmt.Errorf("rpc balancer: no available servers")
+	}
+	best := ""
+	for _, s := range b.servers {
+		b.current[s.Addr] += s.Weight
+		if best == "" || b.current[s.Addr] > b.current[best] {
+			best = s.Addr
+		}
+	}
+	b.current[best] -= b.total
+	return best, nil, nil
+}
+
+// weightedRandomBalancer is WeightedRandomSelect
+type weightedRandomBalancer struct {
+	serverList
+}
+
+func (b *weightedRandomBalancer) Pick(PickInfo) (string, func(DoneInfo), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(b.servers)
+	if n == 0 {
+		return "", nil, fmt.Errorf("rpc balancer: no available servers")
+	}
+	r := b.intn(b.total)
+	for _, s := range b.servers {
+		if r -= s.Weight; r < 0 {
+			return s.Addr, nil, nil
+		}
+	}
+	return b.servers[n-1].Addr, nil, nil
+}
+
+// consistentHashBalancer is ConsistentHashSelect, calls without a key go to a random server
+type consistentHashBalancer struct {
+	serverList
+	ring *Map // consistent hash ring of servers
+}
+
+func newConsistentHashBalancer() Balancer {
+	return &consistentHashBalancer{ring: New(ringReplicas, fnv32a)}
+}
+
+// Update replaces the servers, only the new, gone and reweighted ones change on the ring
+func (b *consistentHashBalancer) Update(servers []ServerInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	old := make(map[string]int, len(b.servers))
+	for _, s := range b.servers {
+		old[s.Addr] = s.Weight
+	}
+	b.set(servers)
+	weights := make(map[string]int, len(b.servers))
+	for _, s := range b.servers {
+		weights[s.Addr] = s.Weight
+		if w, ok := old[s.Addr]; !ok || w != s.Weight {
+			b.ring.AddWeighted(s.Addr, s.Weight)
+		}
+	}
+	for addr := range old {
+		if _, ok := weights[addr]; !ok {
+			b.ring.Remove(addr)
+		}
+	}
+}
+
+func (b *consistentHashBalancer) Pick(info PickInfo) (string, func(DoneInfo), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !info.HasKey || len(b.servers) == 0 {
+		return b.random()
+	}
+	return b.ring.Get(info.Key), nil, nil
+}
+
+// balanced is a Balancer of a XClient with the servers it was last given
+type balanced struct {
+	Balancer
+	servers []ServerInfo
+}
+
+// SetBalancer makes xc pick the servers of its calls with b instead of the balancer of its select mode,
+// the calls of CallWithKey included
+func (xc *XClient) SetBalancer(b Balancer) {
+	xc.balanceMu.Lock()
+	defer xc.balanceMu.Unlock()
+	xc.balancer = &balanced{Balancer: b}
+	xc.keyed = nil
+}
+
+// UseBalancer is SetBalancer with a new balancer registered under name
+func (xc *XClient) UseBalancer(name string) error {
+	b, err := NewBalancer(name)
+	if err != nil {
+		return err
+	}
+	xc.SetBalancer(b)
+	return nil
+}
+
+// serverInfos returns the servers of the discovery, with weight 1 if it isn't a WeightedDiscovery
+func (xc *XClient) serverInfos() ([]ServerInfo, error) {
+	if wd, ok := xc.d.(WeightedDiscovery); ok {
+		return wd.GetAllWeighted()
+	}
+	addrs, err := xc.d.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	servers := make([]ServerInfo, len(addrs))
+	for i, addr := range addrs {
+		servers[i] = ServerInfo{Addr: addr, Weight: 1}
+	}
+	return servers, nil
+}
+
+// balancerOf returns the balancer of the call, updated with the servers which are healthy as told by isHealthy,
+// and these servers
+func (xc *XClient) balancerOf(info PickInfo) (Balancer, []ServerInfo, error) {
+	servers, err := xc.serverInfos()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(servers) == 0 {
+		return nil, nil, fmt.Errorf("rpc discovery: no available servers")
+	}
+	healthy := make([]ServerInfo, 0, len(servers))
+	for _, s := range servers {
+		if xc.isHealthy(s.Addr) {
+			healthy = append(healthy, s)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil, nil, Errorf(CodeUnavailable, "rpc xclient: no serving servers among %d", len(servers))
+	}
+	xc.balanceMu.Lock()
+	defer xc.balanceMu.Unlock()
+	if !sameServers(xc.listed, servers) {
+		addrs := make([]string, len(servers))
+		for i, s := range servers {
+			addrs[i] = s.Addr
+		}
+		xc.pruneBreakers(addrs)
+		xc.listed = servers
+	}
+	b := xc.balancer
+	if info.HasKey && xc.keyed != nil {
+		b = xc.keyed
+	}
+	if b == nil {
+		return nil, nil, fmt.Errorf("rpc discovery: not supported select mode")
+	}
+	if !sameServers(b.servers, healthy) {
+		b.Update(healthy)
+		b.servers = healthy
+	}
+	return b.Balancer, healthy, nil
+}
+
+func sameServers(a, b []ServerInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// pick picks a healthy server for the call, trying to get one not in tried. It returns a tried one if all were.
+func (xc *XClient) pick(info PickInfo, tried map[string]bool) (string, func(DoneInfo), error) {
+	b, servers, err := xc.balancerOf(info)
+	if err != nil {
+		return "", nil, err
+	}
+	for i := 0; i < len(servers); i++ { // round robin gets to every server, random likely gets to an untried one
+		rpcAddr, done, err := b.Pick(info)
+		if err != nil || !tried[rpcAddr] {
+			return rpcAddr, done, err
+		}
+		if done != nil {
+			done(DoneInfo{Canceled: true})
+		}
+	}
+	for _, s := range servers {
+		if !tried[s.Addr] {
+			return s.Addr, nil, nil
+		}
+	}
+	return b.Pick(info)
+}
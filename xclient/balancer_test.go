@@ -0,0 +1,116 @@
+package xclient
+
+import (
+	"context"
+	. "geerpc"
+	"sync"
+	"testing"
+)
+
+// lastBalancer picks the last server, and records what it is given
+type lastBalancer struct {
+	mu      sync.Mutex
+	servers []ServerInfo
+	picks   []PickInfo
+	dones   []DoneInfo
+}
+
+func (b *lastBalancer) Update(servers []ServerInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.servers = servers
+}
+
+func (b *lastBalancer) Pick(info PickInfo) (string, func(DoneInfo), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.picks = append(b.picks, info)
+	return b.servers[len(b.servers)-1].Addr, func(di DoneInfo) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.dones = append(b.dones, di)
+	}, nil
+}
+
+func TestXClient_UseBalancer(t *testing.T) {
+	b := new(lastBalancer)
+	RegisterBalancer("last", func() Balancer { return b })
+	if _, err := NewBalancer("first"); err == nil {
+		t.Fatal("expect an unknown balancer to fail")
+	}
+
+	servers := startServers(t, &Napper{Name: "a"}, &Napper{Name: "b"})
+	d := NewMultiServerDiscovery([]string{servers[0], servers[1] + ";weight=3"})
+	xc := NewXClient(d, RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	if err := xc.UseBalancer("last"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithMetadata(context.Background(), Metadata{"tenant": "t1"})
+	var name string
+	if err := xc.CallWithKey(ctx, "k", "Napper.Nap", 0, &name); err != nil || name != "b" {
+		t.Fatal("expect the server picked by the balancer, got", name, err)
+	}
+	if len(b.servers) != 2 || b.servers[1].Weight != 3 {
+		t.Fatal("expect the balancer to get the servers with their weights, got", b.servers)
+	}
+	info := b.picks[0]
+	if info.ServiceMethod != "Napper.Nap" || !info.HasKey || info.Key != "k" || info.Metadata["tenant"] != "t1" ||
+		info.Pending == nil {
+		t.Fatal("expect the call info, got", info)
+	}
+	if len(b.dones) != 1 || b.dones[0].Err != nil || b.dones[0].Failed || b.dones[0].Canceled || b.dones[0].Latency <= 0 {
+		t.Fatal("expect the outcome of the call, got", b.dones)
+	}
+
+	if err := xc.Call(context.Background(), "Napper.Missing", 0, &name); err == nil {
+		t.Fatal("expect a missing method to fail")
+	}
+	if di := b.dones[1]; di.Err == nil || di.Failed {
+		t.Fatal("expect a request error not to be a failure of the server, got", di)
+	}
+
+	_ = d.Update(servers[:1])
+	if err := xc.Call(context.Background(), "Napper.Nap", 0, &name); err != nil || name != "a" {
+		t.Fatal("expect the balancer to follow the server list, got", name, err)
+	}
+}
+
+func TestBalancers(t *testing.T) {
+	servers := []ServerInfo{{Addr: "a", Weight: 1}, {Addr: "b", Weight: 1}, {Addr: "c", Weight: 1}}
+	for _, mode := range []SelectMode{RandomSelect, RoundRobinSelect, ConsistentHashSelect, WeightedRoundRobinSelect,
+		WeightedRandomSelect, LeastPendingSelect, P2CSelect} {
+		b, err := NewBalancer(mode.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := b.Pick(PickInfo{}); err == nil {
+			t.Fatal(mode, "expect no servers to fail")
+		}
+		b.Update(servers)
+		counts := make(map[string]int)
+		for i := 0; i < 300; i++ {
+			rpcAddr, done, err := b.Pick(PickInfo{})
+			if err != nil {
+				t.Fatal(mode, err)
+			}
+			if done != nil {
+				done(DoneInfo{})
+			}
+			counts[rpcAddr]++
+		}
+		if len(counts) != 3 {
+			t.Fatal(mode, "expect every server to be picked, got", counts)
+		}
+	}
+
+	b, _ := NewBalancer(ConsistentHashSelect.String())
+	b.Update(servers)
+	owner, _, _ := b.Pick(PickInfo{Key: "k", HasKey: true})
+	for i := 0; i < 10; i++ {
+		if rpcAddr, _, _ := b.Pick(PickInfo{Key: "k", HasKey: true}); rpcAddr != owner {
+			t.Fatal("expect the same server for the same key, got", owner, rpcAddr)
+		}
+	}
+}
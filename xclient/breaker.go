@@ -0,0 +1,252 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "geerpc"
+	"time"
+)
+
+// BreakerState is the state of the circuit breaker of a server
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // calls go through
+	BreakerOpen                         // the server is failing, it is skipped
+	BreakerHalfOpen                     // a few trial calls go through to see if the server recovered
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "CLOSED"
+	case BreakerOpen:
+		return "OPEN"
+	case BreakerHalfOpen:
+		return "HALF_OPEN"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// BreakerOptions configures the circuit breakers of a XClient
+type BreakerOptions struct {
+	ConsecutiveFailures int           // failures in a row opening the breaker, 0 means 5
+	ErrorRate           float64       // ratio of failed calls in Window opening the breaker, 0 means 0.5
+	MinRequests         int           // calls in Window before ErrorRate applies, 0 means 20
+	Window              time.Duration // 0 means 10s
+	OpenTimeout         time.Duration // time open before letting trial calls through, 0 means 5s
+	HalfOpenRequests    int           // trial calls which must succeed to close the breaker, 0 means 1
+}
+
+// breaker is the circuit breaker of one server, guarded by XClient.breakerMu
+type breaker struct {
+	state       BreakerState
+	consecutive int // failures in a row
+	requests    int // calls in the current window
+	failures    int // failed calls in the current window
+	windowStart time.Time
+	openedAt    time.Time
+	trials      int // trial calls in flight when half open
+	successes   int // trial calls which succeeded
+	gen         int // incremented by every state change, calls acquired in another one aren't recorded
+}
+
+// available reports whether the server may be selected
+func (b *breaker) available(opts *BreakerOptions, now time.Time) bool {
+	switch b.state {
+	case BreakerOpen:
+		return now.Sub(b.openedAt) >= opts.OpenTimeout
+	case BreakerHalfOpen:
+		return b.trials+b.successes < opts.HalfOpenRequests
+	default:
+		return true
+	}
+}
+
+// acquire reports whether a call may be sent, counting it as a trial call if half open,
+// and returns the generation to record the call with
+func (b *breaker) acquire(opts *BreakerOptions, now time.Time) (int, bool) {
+	if !b.available(opts, now) {
+		return 0, false
+	}
+	if b.state == BreakerOpen {
+		b.state, b.trials, b.successes, b.gen = BreakerHalfOpen, 0, 0, b.gen+1
+	}
+	if b.state == BreakerHalfOpen {
+		b.trials++
+	}
+	return b.gen, true
+}
+
+// record records the outcome of a call acquired in generation gen,
+// counted is false if the call was cancelled by the caller
+func (b *breaker) record(opts *BreakerOptions, now time.Time, gen int, failed, counted bool) {
+	if gen != b.gen {
+		return
+	}
+	if b.state == BreakerHalfOpen {
+		b.trials--
+		if !counted {
+			return
+		}
+		if failed {
+			b.open(now)
+			return
+		}
+		if b.successes++; b.successes >= opts.HalfOpenRequests {
+			*b = breaker{state: BreakerClosed, windowStart: now, gen: b.gen + 1}
+		}
+		return
+	}
+	if !counted {
+		return
+	}
+	if now.Sub(b.windowStart) >= opts.Window {
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+	b.requests++
+	if !failed {
+		b.consecutive = 0
+		return
+	}
+	b.failures++
+	b.consecutive++
+	if b.consecutive >= opts.ConsecutiveFailures ||
+		(b.requests >= opts.MinRequests && float64(b.failures) >= opts.ErrorRate*float64(b.requests)) {
+		b.open(now)
+	}
+}
+
+func (b *breaker) open(now time.Time) {
+	*b = breaker{state: BreakerOpen, openedAt: now, gen: b.gen + 1}
+}
+
+// callOutcome tells whether a call failed because of the server, and whether it counts at all for the breakers and
+// the load balancing: calls cancelled by the caller, e.g. a losing hedge, don't, errors about the request aren't failures
+func callOutcome(ctx context.Context, err error) (failed, counted bool) {
+	if err == nil {
+		return false, true
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return false, false
+	}
+	switch CodeOf(err) {
+	case CodeInvalidArgument, CodeNotFound, CodeUnauthenticated, CodePermissionDenied:
+		return false, true
+	}
+	return true, true
+}
+
+// EnableCircuitBreaker gives every server a circuit breaker, which opens on consecutive failures or a high error
+// rate. Servers whose breaker is open are skipped by the selection until OpenTimeout has passed, then trial calls
+// close the breaker again if they succeed.
+func (xc *XClient) EnableCircuitBreaker(opts BreakerOptions) {
+	if opts.ConsecutiveFailures <= 0 {
+		opts.ConsecutiveFailures = 5
+	}
+	if opts.ErrorRate <= 0 {
+		opts.ErrorRate = 0.5
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = 20
+	}
+	if opts.Window <= 0 {
+		opts.Window = time.Second * 10
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = time.Second * 5
+	}
+	if opts.HalfOpenRequests <= 0 {
+		opts.HalfOpenRequests = 1
+	}
+	xc.breakerMu.Lock()
+	defer xc.breakerMu.Unlock()
+	xc.breakerOpts = &opts
+	xc.breakers = make(map[string]*breaker)
+}
+
+// BreakerState returns the state of the circuit breaker of rpcAddr, closed if breakers aren't enabled
+func (xc *XClient) BreakerState(rpcAddr string) BreakerState {
+	xc.breakerMu.Lock()
+	defer xc.breakerMu.Unlock()
+	if b := xc.breakers[rpcAddr]; b != nil {
+		return b.state
+	}
+	return BreakerClosed
+}
+
+// BreakerStates returns the state of the circuit breaker of every server called so far, which is still listed by
+// the discovery
+func (xc *XClient) BreakerStates() map[string]BreakerState {
+	xc.breakerMu.Lock()
+	defer xc.breakerMu.Unlock()
+	states := make(map[string]BreakerState, len(xc.breakers))
+	for rpcAddr, b := range xc.breakers {
+		states[rpcAddr] = b.state
+	}
+	return states
+}
+
+// pruneBreakers drops the breakers of the servers which aren't in servers anymore
+func (xc *XClient) pruneBreakers(servers []string) {
+	xc.breakerMu.Lock()
+	defer xc.breakerMu.Unlock()
+	if len(xc.breakers) == 0 {
+		return
+	}
+	listed := make(map[string]bool, len(servers))
+	for _, rpcAddr := range servers {
+		listed[rpcAddr] = true
+	}
+	for rpcAddr := range xc.breakers {
+		if !listed[rpcAddr] {
+			delete(xc.breakers, rpcAddr)
+		}
+	}
+}
+
+// breakerAvailable reports whether the breaker of rpcAddr lets it be selected
+func (xc *XClient) breakerAvailable(rpcAddr string) bool {
+	xc.breakerMu.Lock()
+	defer xc.breakerMu.Unlock()
+	b := xc.breakers[rpcAddr]
+	return b == nil || b.available(xc.breakerOpts, time.Now())
+}
+
+// acquireBreaker reports whether a call may be sent to rpcAddr, callers must then call releaseBreaker with gen
+func (xc *XClient) acquireBreaker(rpcAddr string) (gen int, ok bool) {
+	xc.breakerMu.Lock()
+	defer xc.breakerMu.Unlock()
+	if xc.breakerOpts == nil {
+		return 0, true
+	}
+	b := xc.breakers[rpcAddr]
+	if b == nil {
+		b = &breaker{windowStart: time.Now()}
+		xc.breakers[rpcAddr] = b
+	}
+	state := b.state
+	gen, ok = b.acquire(xc.breakerOpts, time.Now())
+	if b.state != state {
+		xc.logger.Info("rpc xclient: circuit breaker", "addr", rpcAddr, "state", b.state.String())
+	}
+	return gen, ok
+}
+
+// releaseBreaker records the result of a call to rpcAddr made with ctx
+func (xc *XClient) releaseBreaker(rpcAddr string, gen int, ctx context.Context, err error) {
+	xc.breakerMu.Lock()
+	defer xc.breakerMu.Unlock()
+	b := xc.breakers[rpcAddr]
+	if b == nil {
+		return
+	}
+	state := b.state
+	failed, counted := callOutcome(ctx, err)
+	b.record(xc.breakerOpts, time.Now(), gen, failed, counted)
+	if b.state != state {
+		xc.logger.Warn("rpc xclient: circuit breaker", "addr", rpcAddr, "state", b.state.String(), "err", err)
+	}
+}
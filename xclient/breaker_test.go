@@ -0,0 +1,125 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	. "geerpc"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	opts := &BreakerOptions{ConsecutiveFailures: 3, ErrorRate: 0.5, MinRequests: 6, Window: time.Minute,
+		OpenTimeout: time.Second, HalfOpenRequests: 2}
+	now := time.Now()
+	b := &breaker{windowStart: now}
+	call := func(failed, counted bool) bool {
+		gen, ok := b.acquire(opts, now)
+		if ok {
+			b.record(opts, now, gen, failed, counted)
+		}
+		return ok
+	}
+
+	call(true, true)
+	call(true, true)
+	call(true, false) // cancelled by the caller
+	call(false, true)
+	call(true, true)
+	call(false, true)
+	if b.state != BreakerClosed {
+		t.Fatal("expect successes to reset the consecutive failures, got", b.state)
+	}
+	call(true, true) // 4 failures out of 6
+	if b.state != BreakerOpen {
+		t.Fatal("expect the error rate to open the breaker, got", b.state)
+	}
+	if call(false, true) {
+		t.Fatal("expect an open breaker to reject calls")
+	}
+
+	now = now.Add(opts.OpenTimeout)
+	gen1, ok1 := b.acquire(opts, now)
+	gen2, ok2 := b.acquire(opts, now)
+	if _, ok := b.acquire(opts, now); !ok1 || !ok2 || ok || b.state != BreakerHalfOpen {
+		t.Fatal("expect HalfOpenRequests trial calls, got", ok1, ok2, ok, b.state)
+	}
+	b.record(opts, now, gen1, false, true)
+	b.record(opts, now, gen2, true, true)
+	if b.state != BreakerOpen {
+		t.Fatal("expect a failed trial call to open the breaker again, got", b.state)
+	}
+
+	now = now.Add(opts.OpenTimeout)
+	call(false, true)
+	call(false, true)
+	if b.state != BreakerClosed {
+		t.Fatal("expect successful trial calls to close the breaker, got", b.state)
+	}
+	for i := 0; i < 3; i++ {
+		call(true, true)
+	}
+	if b.state != BreakerOpen {
+		t.Fatal("expect consecutive failures to open the breaker, got", b.state)
+	}
+}
+
+func TestCallOutcome(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, tt := range []struct {
+		err             error
+		failed, counted bool
+	}{
+		{nil, false, true},
+		{Errorf(CodeUnavailable, "down"), true, true},
+		{Errorf(CodeInvalidArgument, "bad"), false, true},
+		{errors.New("connection reset"), true, true},
+	} {
+		if failed, counted := callOutcome(ctx, tt.err); failed != tt.failed || counted != tt.counted {
+			t.Fatal("unexpected outcome of", tt.err, failed, counted)
+		}
+	}
+	cancel()
+	if _, counted := callOutcome(ctx, ctx.Err()); counted {
+		t.Fatal("expect calls cancelled by the caller not to count")
+	}
+}
+
+func TestXClient_EnableCircuitBreaker(t *testing.T) {
+	down, up := &Shaky{Down: true}, &Shaky{}
+	servers := startServers(t, down, up)
+	downAddr, upAddr := servers[0], servers[1]
+	d := NewMultiServerDiscovery(servers)
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.EnableCircuitBreaker(BreakerOptions{ConsecutiveFailures: 2, OpenTimeout: time.Millisecond * 100})
+
+	failed := 0
+	for i := 0; i < 10; i++ {
+		var ok bool
+		if err := xc.Call(context.Background(), "Shaky.Put", 0, &ok); err != nil {
+			failed++
+		}
+	}
+	if failed != 2 || atomic.LoadInt32(&down.calls) != 2 || xc.BreakerState(downAddr) != BreakerOpen {
+		t.Fatal("expect the failing server to be skipped once its breaker opens, got", failed, "failures,",
+			xc.BreakerStates())
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	for i := 0; i < 4; i++ {
+		var ok bool
+		_ = xc.Call(context.Background(), "Shaky.Put", 0, &ok)
+	}
+	if atomic.LoadInt32(&down.calls) != 3 || xc.BreakerState(downAddr) != BreakerOpen {
+		t.Fatal("expect one trial call opening the breaker again, got", down.calls, "calls,", xc.BreakerStates())
+	}
+
+	_ = d.Update([]string{upAddr})
+	var ok bool
+	_ = xc.Call(context.Background(), "Shaky.Put", 0, &ok)
+	if states := xc.BreakerStates(); len(states) != 1 || states[upAddr] != BreakerClosed {
+		t.Fatal("expect the breaker of a removed server to be dropped, got", states)
+	}
+}
@@ -2,27 +2,51 @@ package xclient
 
 import (
 	"hash/crc32"
+	"hash/fnv"
+	"math"
 	"sort"
 	"strconv"
+	"sync"
 )
 
 // Hash maps bytes to uint32
 type Hash func(data []byte) uint32
 
-// Map constains all hashed keys
+// vnode is a virtual node on the ring
+type vnode struct {
+	hash uint32
+	key  string
+}
+
+// Map constains all hashed keys, it is safe for concurrent use
 type Map struct {
 	hash     Hash
-	replicas int            // number of virtual nodes
-	keys     []int          // Sorted
-	hashMap  map[int]string // hash and key
+	replicas int     // number of virtual nodes per unit of weight
+	epsilon  float64 // load bound of GetLeast, see NewBounded
+
+	mu      sync.Mutex       // protect following
+	nodes   []vnode          // sorted by hash then key, so that colliding hashes keep every key
+	weights map[string]int   // weight of every key
+	loads   map[string]int64 // load of every key, for GetLeast
+	total   int64            // sum of loads
+	weight  int              // sum of weights
 }
 
-// New creates a Map instance
+// fnv32a is the Hash of the rings of XClient, it spreads the similar names of the virtual nodes of a key more
+// evenly than crc32
+func fnv32a(data []byte) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write(data)
+	return h.Sum32()
+}
+
+// New creates a Map instance, fn defaults to crc32.ChecksumIEEE
 func New(replicas int, fn Hash) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash:     fn,
-		hashMap:  make(map[int]string),
+		weights:  make(map[string]int),
+		loads:    make(map[string]int64),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
@@ -30,29 +54,156 @@ func New(replicas int, fn Hash) *Map {
 	return m
 }
 
+// NewBounded creates a Map for consistent hashing with bounded loads: GetLeast never picks a key whose load would
+// exceed (1+epsilon) times the average load, weighted by the weights of the keys.
+func NewBounded(replicas int, epsilon float64, fn Hash) *Map {
+	m := New(replicas, fn)
+	m.epsilon = epsilon
+	return m
+}
+
 // Add adds some keys to the hash
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+		m.AddWeighted(key, 1)
+	}
+}
+
+// AddWeighted adds key with weight times the replicas of Add, so that it gets weight times the share of keys.
+// Adding a key again changes its weight. Weights below 1 are 1.
+func (m *Map) AddWeighted(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.weights[key]; ok {
+		m.remove(key)
+	}
+	m.weights[key] = weight
+	m.weight += weight
+	for i := 0; i < m.replicas*weight; i++ {
+		m.nodes = append(m.nodes, vnode{hash: m.hash([]byte(strconv.Itoa(i) + key)), key: key})
+	}
+	sort.Slice(m.nodes, func(i, j int) bool {
+		if m.nodes[i].hash != m.nodes[j].hash {
+			return m.nodes[i].hash < m.nodes[j].hash
+		}
+		return m.nodes[i].key < m.nodes[j].key
+	})
+}
+
+// Remove removes some keys from the hash, only the hashed keys which were closest to them move
+func (m *Map) Remove(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		if _, ok := m.weights[key]; ok {
+			m.remove(key)
 		}
 	}
-	sort.Ints(m.keys)
+}
+
+// remove removes key, which is in the map, m.mu must be held
+func (m *Map) remove(key string) {
+	nodes := m.nodes[:0]
+	for _, n := range m.nodes {
+		if n.key != key {
+			nodes = append(nodes, n)
+		}
+	}
+	m.nodes = nodes
+	m.weight -= m.weights[key]
+	m.total -= m.loads[key]
+	delete(m.weights, key)
+	delete(m.loads, key)
+}
+
+// Keys returns the keys in the hash, sorted
+func (m *Map) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.weights))
+	for key := range m.weights {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// search returns the index of the first virtual node at or after the hash of key, m.mu must be held
+func (m *Map) search(key string) int {
+	hash := m.hash([]byte(key))
+	idx := sort.Search(len(m.nodes), func(i int) bool {
+		return m.nodes[i].hash >= hash
+	})
+	if idx == len(m.nodes) {
+		idx = 0
+	}
+	return idx
 }
 
 // Get gets the closest item in the hash to the provided key
 func (m *Map) Get(key string) string {
-	if len(m.keys) == 0 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.nodes) == 0 {
 		return ""
 	}
-	hash := int(m.hash([]byte(key)))
-	idx := sort.Search(len(m.keys), func(i int) bool {
-		return m.keys[i] >= hash
-	})
-	if idx == len(m.keys) {
-		idx = 0
+	return m.nodes[m.search(key)].key
+}
+
+// GetLeast is like Get, but walks the ring past the items whose load has reached their bound, see NewBounded.
+// The load of an item is the number of Inc minus the number of Done of it.
+func (m *Map) GetLeast(key string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.nodes) == 0 {
+		return ""
+	}
+	idx := m.search(key)
+	for i := 0; i < len(m.nodes); i++ {
+		n := m.nodes[(idx+i)%len(m.nodes)]
+		if m.loads[n.key]+1 <= m.maxLoad(n.key) {
+			return n.key
+		}
+	}
+	return m.nodes[idx].key // not reached, some item is below the average
+}
+
+// maxLoad returns the bound of the load of key, m.mu must be held
+func (m *Map) maxLoad(key string) int64 {
+	avg := float64(m.total+1) * float64(m.weights[key]) / float64(m.weight)
+	return int64(math.Ceil(avg * (1 + m.epsilon)))
+}
+
+// Inc adds one to the load of key, e.g. when a request is sent to it
+func (m *Map) Inc(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.weights[key]; ok {
+		m.loads[key]++
+		m.total++
+	}
+}
+
+// Done removes one from the load of key, e.g. when a request sent to it is done
+func (m *Map) Done(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.loads[key] > 0 {
+		m.loads[key]--
+		m.total--
+	}
+}
+
+// Loads returns the load of every key
+func (m *Map) Loads() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	loads := make(map[string]int64, len(m.weights))
+	for key := range m.weights {
+		loads[key] = m.loads[key]
 	}
-	return m.hashMap[m.keys[idx]]
+	return loads
 }
@@ -0,0 +1,144 @@
+package xclient
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestMap_Get(t *testing.T) {
+	m := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	m.Add("6", "4", "2") // 2/4/6, 12/14/16, 22/24/26
+	for k, v := range map[string]string{"2": "2", "11": "2", "23": "4", "27": "2"} {
+		if got := m.Get(k); got != v {
+			t.Fatal("asking for", k, "expect", v, "got", got)
+		}
+	}
+	m.Add("8") // 8, 18, 28
+	if got := m.Get("27"); got != "8" {
+		t.Fatal("expect 27 to move to 8, got", got)
+	}
+	m.Remove("8")
+	if got := m.Get("27"); got != "2" {
+		t.Fatal("expect 27 to move back to 2, got", got)
+	}
+}
+
+func TestMap_collision(t *testing.T) {
+	m := New(4, func([]byte) uint32 { return 42 })
+	m.Add("a", "b")
+	if got := m.Get("x"); got != "a" {
+		t.Fatal("expect colliding keys to be ordered by name, got", got)
+	}
+	m.Remove("a")
+	if got := m.Get("x"); got != "b" {
+		t.Fatal("expect the colliding key to survive the removal of the other, got", got)
+	}
+}
+
+// spread gets n keys and returns the number of keys per node
+func spread(m *Map, n int, get func(string) string) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[get("key-"+strconv.Itoa(i))]++
+	}
+	return counts
+}
+
+func TestMap_distribution(t *testing.T) {
+	m := New(100, fnv32a)
+	var nodes []string
+	for i := 0; i < 10; i++ {
+		nodes = append(nodes, "tcp@10.0.0."+strconv.Itoa(i)+":9999")
+	}
+	m.Add(nodes...)
+	const keys = 100000
+	before := spread(m, keys, m.Get)
+	for _, node := range nodes {
+		if share := float64(before[node]) / (keys / 10); share < 0.6 || share > 1.4 {
+			t.Fatalf("expect about a tenth of the keys on every node, %s has %.2f of the average", node, share)
+		}
+	}
+
+	owners := make([]string, keys)
+	for i := range owners {
+		owners[i] = m.Get("key-" + strconv.Itoa(i))
+	}
+	m.Remove(nodes[0])
+	moved := 0
+	for i, owner := range owners {
+		if got := m.Get("key-" + strconv.Itoa(i)); got == nodes[0] {
+			t.Fatal("expect no key on the removed node")
+		} else if got != owner {
+			moved++
+		}
+	}
+	if moved != before[nodes[0]] {
+		t.Fatal("expect only the keys of the removed node to move, moved", moved, "of", before[nodes[0]])
+	}
+}
+
+func TestMap_AddWeighted(t *testing.T) {
+	m := New(100, fnv32a)
+	m.Add("a", "b")
+	m.AddWeighted("c", 2)
+	counts := spread(m, 40000, m.Get)
+	if share := float64(counts["c"]) / 20000; share < 0.8 || share > 1.2 {
+		t.Fatalf("expect c to get half of the keys, got %.2f of that", share)
+	}
+	m.AddWeighted("c", 1)
+	counts = spread(m, 30000, m.Get)
+	if share := float64(counts["c"]) / 10000; share < 0.7 || share > 1.3 {
+		t.Fatalf("expect the new weight to replace the old one, c got %.2f of a third", share)
+	}
+}
+
+func TestMap_GetLeast(t *testing.T) {
+	const epsilon = 0.25
+	// a ring where "hot" owns nearly every key
+	m := NewBounded(1, epsilon, func(key []byte) uint32 {
+		switch string(key) {
+		case "0hot":
+			return math.MaxUint32
+		case "0cold1":
+			return 1
+		case "0cold2":
+			return 2
+		}
+		return uint32(len(key))
+	})
+	m.Add("hot", "cold1")
+	m.AddWeighted("cold2", 2)
+	const keys = 4000
+	counts := spread(m, keys, func(key string) string {
+		node := m.GetLeast(key)
+		m.Inc(node)
+		return node
+	})
+	for node, w := range map[string]float64{"hot": 1, "cold1": 1, "cold2": 2} {
+		bound := math.Ceil(keys * w / 4 * (1 + epsilon))
+		if float64(counts[node]) > bound {
+			t.Fatal("expect", node, "to get at most", bound, "keys, got", counts[node])
+		}
+	}
+	if loads := m.Loads(); loads["hot"] != int64(counts["hot"]) {
+		t.Fatal("expect the loads to count the keys, got", loads)
+	}
+	if counts["hot"] < keys/4 {
+		t.Fatal("expect the hot node to be filled up to its bound, got", counts["hot"])
+	}
+
+	for i := 0; i < counts["hot"]; i++ {
+		m.Done("hot")
+	}
+	if got := m.GetLeast("key-1000"); got != "hot" {
+		t.Fatal("expect the hot node to get keys again once its load is done, got", got)
+	}
+	m.Remove("hot")
+	if got := m.GetLeast("key-1000"); got == "hot" || got == "" {
+		t.Fatal("expect a removed node to lose its load, got", got)
+	}
+}
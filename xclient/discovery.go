@@ -2,72 +2,176 @@ package xclient
 
 import (
 	"fmt"
-	"math"
-	"math/rand"
+	. "geerpc"
 	"sync"
-	"time"
 )
 
+// SelectMode selects a built-in Balancer, registered under the name returned by String
 type SelectMode int
 
 const (
 	RandomSelect SelectMode = iota
 	RoundRobinSelect
+	// ConsistentHashSelect sends the calls of XClient.CallWithKey with the same key to the same server,
+	// as long as the server list doesn't change. Calls without a key go to a random server.
+	ConsistentHashSelect
+	// WeightedRoundRobinSelect is the smooth weighted round robin of nginx: every server gets its share of the
+	// calls in proportion to its weight, spread evenly, e.g. a a b a c a a for weights a 5, b 1, c 1
+	WeightedRoundRobinSelect
+	WeightedRandomSelect // a random server, with the odds of every server in proportion to its weight
+	// LeastPendingSelect picks the server whose connection has the fewest calls waiting for a reply.
+	// It needs the state of the clients, only XClient supports it.
+	LeastPendingSelect
+	// P2CSelect picks two random servers and takes the one with the lower peak EWMA latency times pending calls,
+	// the power of two choices. It needs the state of the clients, only XClient supports it.
+	P2CSelect
 )
 
+// ringReplicas is the number of virtual nodes of every server on the consistent hash ring
+const ringReplicas = 50
+
+// Discovery finds the servers. The entries of a server list are addresses accepted by XDial, optionally with
+// a weight as in tcp@10.0.0.1:9999;weight=3, see ParseWeightedAddr. GetAll returns the addresses only.
+// Picking a server among them is the job of a Balancer, see XClient.SetBalancer.
 type Discovery interface {
-	Refresh() error                      // refresh from remote registry
-	Update(servers []string) error       // update with provided server list
+	Refresh() error                // refresh from remote registry
+	Update(servers []string) error // update with provided server list
+	GetAll() ([]string, error)     // get all servers in the registry
+}
+
+// SelectingDiscovery is a Discovery which can also pick a server itself, like the built-in ones do with the
+// built-in balancers. XClient doesn't use Get, it picks with its Balancer.
+type SelectingDiscovery interface {
+	Discovery
 	Get(mode SelectMode) (string, error) // get a server according to the mode
-	GetAll() ([]string, error)           // get all servers in the registry
 }
 
+// KeyedDiscovery is a SelectingDiscovery which can also select a server by key
+type KeyedDiscovery interface {
+	SelectingDiscovery
+	GetByKey(key string) (string, error) // get the server of key on a consistent hash ring
+}
+
+// WeightedDiscovery is a Discovery which also gives the weights of the servers, for the Balancer of XClient
+type WeightedDiscovery interface {
+	Discovery
+	GetAllWeighted() ([]ServerInfo, error) // get all servers with their weights
+}
+
+// MultiServersDiscovery is a Discovery of a server list given by the user, Get picks with the built-in balancers
 type MultiServersDiscovery struct {
-	r       *rand.Rand
-	mu      sync.Mutex
-	servers []string // server list
-	index   int      // record the selected position
+	mu        sync.Mutex
+	servers   []string                // server list
+	weights   map[string]int          // weight of every server
+	balancers map[SelectMode]Balancer // of Get, by mode
 }
 
+// NewMultiServerDiscovery creates a discovery of the servers, the entries with an invalid weight get weight 1
 func NewMultiServerDiscovery(servers []string) *MultiServersDiscovery {
-	d := &MultiServersDiscovery{
-		servers: servers,
-		r:       rand.New(rand.NewSource(time.Now().UnixNano())),
-	}
-	d.index = d.r.Intn(math.MaxInt32 - 1) // initialize index
+	d := &MultiServersDiscovery{balancers: make(map[SelectMode]Balancer)}
+	_ = d.setServers(servers)
 	return d
 }
 
-var _ Discovery = (*MultiServersDiscovery)(nil)
+var _ KeyedDiscovery = (*MultiServersDiscovery)(nil)
+var _ WeightedDiscovery = (*MultiServersDiscovery)(nil)
+
+// setServers replaces the server list with the entries and updates the balancers.
+// Invalid entries get weight 1, the error of the first one is returned. d.mu must be held.
+func (d *MultiServersDiscovery) setServers(entries []string) error {
+	var err error
+	servers := make([]string, 0, len(entries))
+	weights := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		addr, weight, e := ParseWeightedAddr(entry)
+		if e != nil && err == nil {
+			err = e
+		}
+		if _, ok := weights[addr]; !ok {
+			servers = append(servers, addr)
+		}
+		weights[addr] = weight
+	}
+	d.servers, d.weights = servers, weights
+	if len(servers) > 0 {
+		for _, b := range d.balancers {
+			b.Update(d.serverInfos())
+		}
+	}
+	return err
+}
+
+// serverInfos returns the servers with their weights, d.mu must be held
+func (d *MultiServersDiscovery) serverInfos() []ServerInfo {
+	servers := make([]ServerInfo, len(d.servers))
+	for i, addr := range d.servers {
+		servers[i] = ServerInfo{Addr: addr, Weight: d.weights[addr]}
+	}
+	return servers
+}
 
 func (d *MultiServersDiscovery) Refresh() error {
 	return nil
 }
 
+// Update replaces the server list, it fails without changing it if an entry has an invalid weight
 func (d *MultiServersDiscovery) Update(servers []string) error {
+	for _, entry := range servers {
+		if _, _, err := ParseWeightedAddr(entry); err != nil {
+			return err
+		}
+	}
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	d.servers = servers
-	return nil
+	return d.setServers(servers)
 }
 
-func (d *MultiServersDiscovery) Get(mode SelectMode) (string, error) {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	n := len(d.servers)
-	if n == 0 {
+// pick picks a server with the balancer of mode, which is created on first use. d.mu must be held.
+func (d *MultiServersDiscovery) pick(mode SelectMode, info PickInfo) (string, error) {
+	if len(d.servers) == 0 {
 		return "", fmt.Errorf("rpc discovery: no available servers")
 	}
+	b, ok := d.balancers[mode]
+	if !ok {
+		var err error
+		if b, err = NewBalancer(mode.String()); err != nil {
+			return "", fmt.Errorf("rpc discovery: not supported select mode")
+		}
+		b.Update(d.serverInfos())
+		d.balancers[mode] = b
+	}
+	rpcAddr, done, err := b.Pick(info)
+	if done != nil { // the outcome of the call is unknown here
+		done(DoneInfo{Canceled: true})
+	}
+	return rpcAddr, err
+}
+
+// Get picks a server with the balancer registered under the name of mode, see RegisterBalancer
+func (d *MultiServersDiscovery) Get(mode SelectMode) (string, error) {
 	switch mode {
-	case RandomSelect:
-		return d.servers[d.r.Intn(n)], nil
-	case RoundRobinSelect:
-		s := d.servers[d.index%n] // servers could be updated, take the remainder
-		d.index = (d.index + 1) % n
-		return s, nil
-	default:
-		return "", fmt.Errorf("rpc discovery: not supported select mode")
+	case ConsistentHashSelect:
+		return "", fmt.Errorf("rpc discovery: consistent hash select needs a key, use GetByKey")
+	case LeastPendingSelect, P2CSelect:
+		return "", fmt.Errorf("rpc discovery: select mode needs the state of the clients, use XClient")
 	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pick(mode, PickInfo{})
+}
+
+// GetByKey gets the server of key on the consistent hash ring of the servers
+func (d *MultiServersDiscovery) GetByKey(key string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pick(ConsistentHashSelect, PickInfo{Key: key, HasKey: true})
+}
+
+// GetWeight returns the weight of the server, 0 if it isn't in the list
+func (d *MultiServersDiscovery) GetWeight(rpcAddr string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.weights[rpcAddr]
 }
 
 func (d *MultiServersDiscovery) GetAll() ([]string, error) {
@@ -77,3 +181,10 @@ func (d *MultiServersDiscovery) GetAll() ([]string, error) {
 	copy(servers, d.servers)
 	return servers, nil
 }
+
+// GetAllWeighted gets all servers with their weights
+func (d *MultiServersDiscovery) GetAllWeighted() ([]ServerInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.serverInfos(), nil
+}
@@ -1,7 +1,8 @@
 package xclient
 
 import (
-	"log"
+	. "geerpc"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
@@ -12,6 +13,7 @@ type GeeRegistryDiscovery struct {
 	registry   string // like "http://
 	timeout    time.Duration
 	lastUpdate time.Time
+	logger     *slog.Logger
 }
 
 const defaultUpdateTimeout = time.Second * 10
@@ -24,11 +26,20 @@ func NewGeeRegistryDiscovery(registerAddr string, timeout time.Duration) *GeeReg
 		MultiServersDiscovery: NewMultiServerDiscovery(make([]string, 0)),
 		registry:              registerAddr,
 		timeout:               timeout,
+		logger:                DiscardLogger,
 	}
 	return d
 }
 
-var _ Discovery = (*GeeRegistryDiscovery)(nil)
+// SetLogger sets the logger used to report registry refreshes, NewXClient passes Option.Logger here
+func (d *GeeRegistryDiscovery) SetLogger(logger *slog.Logger) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.logger = logger
+}
+
+var _ KeyedDiscovery = (*GeeRegistryDiscovery)(nil)
+var _ WeightedDiscovery = (*GeeRegistryDiscovery)(nil)
 
 func (d *GeeRegistryDiscovery) Refresh() error {
 	d.mu.Lock()
@@ -36,27 +47,33 @@ func (d *GeeRegistryDiscovery) Refresh() error {
 	if d.lastUpdate.Add(d.timeout).After(time.Now()) {
 		return nil
 	}
-	log.Println("rpc registry: refresh servers from registry", d.registry)
+	d.logger.Debug("rpc registry: refresh servers from registry", "registry", d.registry)
 	resp, err := http.Get(d.registry)
 	if err != nil {
-		log.Println("rpc registry refresh err:", err)
+		d.logger.Error("rpc registry: refresh error", "registry", d.registry, "err", err)
 		return err
 	}
+	_ = resp.Body.Close()
 	servers := strings.Split(resp.Header.Get("X-GeeRPC-Servers"), ",")
-	d.servers = make([]string, 0, len(servers))
+	alive := make([]string, 0, len(servers))
 	for _, server := range servers {
 		if strings.TrimSpace(server) != "" {
-			d.servers = append(d.servers, strings.TrimSpace(server))
+			alive = append(alive, strings.TrimSpace(server))
 		}
 	}
+	if err := d.setServers(alive); err != nil {
+		d.logger.Warn("rpc registry: invalid server", "registry", d.registry, "err", err)
+	}
 	d.lastUpdate = time.Now()
 	return nil
 }
 
 func (d *GeeRegistryDiscovery) Update(servers []string) error {
+	if err := d.MultiServersDiscovery.Update(servers); err != nil {
+		return err
+	}
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	d.servers = servers
 	d.lastUpdate = time.Now()
 	return nil
 }
@@ -68,9 +85,23 @@ func (d *GeeRegistryDiscovery) Get(mode SelectMode) (string, error) {
 	return d.MultiServersDiscovery.Get(mode)
 }
 
+func (d *GeeRegistryDiscovery) GetByKey(key string) (string, error) {
+	if err := d.Refresh(); err != nil { // get latest servers
+		return "", err
+	}
+	return d.MultiServersDiscovery.GetByKey(key)
+}
+
 func (d *GeeRegistryDiscovery) GetAll() ([]string, error) {
 	if err := d.Refresh(); err != nil { // get latest servers
 		return nil, err
 	}
 	return d.MultiServersDiscovery.GetAll()
 }
+
+func (d *GeeRegistryDiscovery) GetAllWeighted() ([]ServerInfo, error) {
+	if err := d.Refresh(); err != nil { // get latest servers
+		return nil, err
+	}
+	return d.MultiServersDiscovery.GetAllWeighted()
+}
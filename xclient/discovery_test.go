@@ -0,0 +1,62 @@
+package xclient
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMultiServersDiscovery_WeightedRoundRobin(t *testing.T) {
+	d := NewMultiServerDiscovery([]string{"a;weight=5", "b", "c;weight=1"})
+	var got []string
+	for i := 0; i < 14; i++ {
+		s, _ := d.Get(WeightedRoundRobinSelect)
+		got = append(got, s)
+	}
+	if seq := strings.Join(got, " "); seq != "a a b a c a a a a b a c a a" {
+		t.Fatal("expect the smooth nginx sequence, got", seq)
+	}
+	if servers, _ := d.GetAll(); strings.Join(servers, ",") != "a,b,c" || d.GetWeight("a") != 5 {
+		t.Fatal("expect the addresses without their weights, got", servers)
+	}
+
+	_ = d.Update([]string{"a", "b;weight=3"})
+	counts := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		s, _ := d.Get(WeightedRoundRobinSelect)
+		counts[s]++
+	}
+	if counts["a"] != 2 || counts["b"] != 6 {
+		t.Fatal("expect the new weights to apply, got", counts)
+	}
+}
+
+func TestMultiServersDiscovery_WeightedRandom(t *testing.T) {
+	d := NewMultiServerDiscovery([]string{"a;weight=3", "b"})
+	counts := make(map[string]int)
+	for i := 0; i < 8000; i++ {
+		s, _ := d.Get(WeightedRandomSelect)
+		counts[s]++
+	}
+	if share := float64(counts["a"]) / 6000; share < 0.9 || share > 1.1 {
+		t.Fatalf("expect a to get three quarters of the calls, got %.2f of that", share)
+	}
+}
+
+func TestMultiServersDiscovery_Update(t *testing.T) {
+	d := NewMultiServerDiscovery([]string{"a;weight=2", "b;weight=x"})
+	if d.GetWeight("b") != 1 {
+		t.Fatal("expect an invalid weight to be 1")
+	}
+	if err := d.Update([]string{"c;weight=-1"}); err == nil {
+		t.Fatal("expect an invalid weight to be rejected")
+	}
+	if servers, _ := d.GetAll(); len(servers) != 2 {
+		t.Fatal("expect a rejected update to keep the servers, got", servers)
+	}
+	_, _ = d.GetByKey("k")
+	_ = d.Update([]string{"a;weight=4"})
+	ring := d.balancers[ConsistentHashSelect].(*consistentHashBalancer).ring
+	if keys := ring.Keys(); len(keys) != 1 || keys[0] != "a" || len(ring.nodes) != 4*ringReplicas {
+		t.Fatal("expect the ring to follow the servers and their weights")
+	}
+}
@@ -0,0 +1,103 @@
+package xclient
+
+import (
+	"context"
+	. "geerpc"
+	"sync"
+	"time"
+)
+
+// EnableHealthCheck makes xc call Health.Check on every server every interval,
+// and stop sending calls to the servers which are not serving until they are again.
+// The first check is done before returning, Close stops checking.
+func (xc *XClient) EnableHealthCheck(interval time.Duration) {
+	xc.healthMu.Lock()
+	if xc.healthDone != nil {
+		xc.healthMu.Unlock()
+		return
+	}
+	done := make(chan struct{})
+	xc.healthDone = done
+	xc.healthMu.Unlock()
+
+	xc.checkHealth(interval)
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				xc.checkHealth(interval)
+			}
+		}
+	}()
+}
+
+func (xc *XClient) stopHealthCheck() {
+	xc.healthMu.Lock()
+	defer xc.healthMu.Unlock()
+	if xc.healthDone != nil {
+		close(xc.healthDone)
+		xc.healthDone = nil
+	}
+}
+
+// checkHealth checks every server concurrently, a server which can't be dialed or answered in time isn't serving
+func (xc *XClient) checkHealth(timeout time.Duration) {
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		xc.logger.Warn("rpc xclient: health check error", "err", err)
+		return
+	}
+	xc.pruneBreakers(servers)
+	unhealthy := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, rpcAddr := range servers {
+		wg.Add(1)
+		go func(rpcAddr string) {
+			defer wg.Done()
+			status := HealthUnknown
+			client, err := xc.dial(rpcAddr)
+			if err == nil {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				var resp HealthCheckResponse
+				if err = client.Call(ctx, HealthService+".Check", HealthCheckRequest{}, &resp); err == nil {
+					status = resp.Status
+				}
+				cancel()
+			}
+			if status != HealthServing {
+				xc.logger.Warn("rpc xclient: server not serving", "addr", rpcAddr, "status", status.String(), "err", err)
+				mu.Lock()
+				unhealthy[rpcAddr] = true
+				mu.Unlock()
+			}
+		}(rpcAddr)
+	}
+	wg.Wait()
+	xc.healthMu.Lock()
+	defer xc.healthMu.Unlock()
+	xc.unhealthy = unhealthy
+}
+
+// isHealthy reports whether rpcAddr was serving at the last health check and its circuit breaker isn't open
+func (xc *XClient) isHealthy(rpcAddr string) bool {
+	xc.healthMu.RLock()
+	unhealthy := xc.unhealthy[rpcAddr]
+	xc.healthMu.RUnlock()
+	return !unhealthy && xc.breakerAvailable(rpcAddr)
+}
+
+// healthy returns the servers which are healthy as told by isHealthy
+func (xc *XClient) healthy(servers []string) []string {
+	healthy := make([]string, 0, len(servers))
+	for _, rpcAddr := range servers {
+		if xc.isHealthy(rpcAddr) {
+			healthy = append(healthy, rpcAddr)
+		}
+	}
+	return healthy
+}
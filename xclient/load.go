@@ -0,0 +1,136 @@
+package xclient
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	ewmaDecay      = time.Second * 10 // time constant of the peak EWMA latency of P2CSelect
+	failurePenalty = time.Second      // added to the latency of a failed call for P2CSelect
+)
+
+// serverLoad is the latency score of a server for P2CSelect
+type serverLoad struct {
+	cost  float64   // peak EWMA of the latency in nanoseconds
+	stamp time.Time // of the last update of cost
+}
+
+// observe adds a latency sample: the cost jumps up to a higher latency at once, and decays towards a lower one
+func (l *serverLoad) observe(rtt time.Duration, now time.Time) {
+	sample := float64(rtt)
+	if sample > l.cost {
+		l.cost = sample
+	} else {
+		w := math.Exp(-float64(now.Sub(l.stamp)) / float64(ewmaDecay))
+		l.cost = l.cost*w + sample*(1-w)
+	}
+	l.stamp = now
+}
+
+// score is the expected wait of a new call, a server not measured yet counts failurePenalty per pending call
+func (l *serverLoad) score(pending int) float64 {
+	if l == nil || l.cost == 0 {
+		return float64(failurePenalty) * float64(pending)
+	}
+	return l.cost * float64(pending+1)
+}
+
+// leastPendingBalancer is LeastPendingSelect, without PickInfo.Pending every server counts as idle
+type leastPendingBalancer struct {
+	serverList
+}
+
+func (b *leastPendingBalancer) Pick(info PickInfo) (string, func(DoneInfo), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.servers) == 0 {
+		return "", nil, fmt.Errorf("rpc balancer: no available servers")
+	}
+	pending := pendingOf(info, b.servers)
+	best, ties := 0, 0
+	for i := range b.servers {
+		switch {
+		case pending[i] < pending[best]:
+			best, ties = i, 1
+		case pending[i] == pending[best]:
+			if ties++; b.intn(ties) == 0 { // a random one of the least pending
+				best = i
+			}
+		}
+	}
+	return b.servers[best].Addr, nil, nil
+}
+
+// p2cBalancer is P2CSelect, it learns the latency of the servers from the outcome of the calls
+type p2cBalancer struct {
+	serverList
+	loads map[string]*serverLoad
+}
+
+func (b *p2cBalancer) Pick(info PickInfo) (string, func(DoneInfo), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(b.servers)
+	if n == 0 {
+		return "", nil, fmt.Errorf("rpc balancer: no available servers")
+	}
+	i := 0
+	if n > 1 {
+		pending := pendingOf(info, b.servers)
+		i = b.intn(n)
+		j := b.intn(n - 1)
+		if j >= i {
+			j++
+		}
+		if b.loads[b.servers[j].Addr].score(pending[j]) < b.loads[b.servers[i].Addr].score(pending[i]) {
+			i = j
+		}
+	}
+	rpcAddr := b.servers[i].Addr
+	return rpcAddr, func(di DoneInfo) { b.observe(rpcAddr, di) }, nil
+}
+
+// observe feeds the latency of a call back, a failed call counts failurePenalty more
+func (b *p2cBalancer) observe(rpcAddr string, di DoneInfo) {
+	if di.Canceled {
+		return
+	}
+	rtt := di.Latency
+	if di.Failed {
+		rtt += failurePenalty
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.loads == nil {
+		b.loads = make(map[string]*serverLoad)
+	}
+	l := b.loads[rpcAddr]
+	if l == nil {
+		l = new(serverLoad)
+		b.loads[rpcAddr] = l
+	}
+	l.observe(rtt, time.Now())
+}
+
+// pendingOf returns the pending calls of every server as told by info.Pending, or zeros
+func pendingOf(info PickInfo, servers []ServerInfo) []int {
+	pending := make([]int, len(servers))
+	if info.Pending != nil {
+		for i, s := range servers {
+			pending[i] = info.Pending(s.Addr)
+		}
+	}
+	return pending
+}
+
+// pending returns the number of calls waiting for a reply from rpcAddr
+func (xc *XClient) pending(rpcAddr string) int {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if client, ok := xc.clients[rpcAddr]; ok {
+		return client.NumPending()
+	}
+	return 0
+}
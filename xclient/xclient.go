@@ -4,32 +4,97 @@ import (
 	"context"
 	. "geerpc"
 	"io"
+	"log/slog"
 	"reflect"
 	"sync"
+	"time"
 )
 
 type XClient struct {
 	d       Discovery
 	mode    SelectMode
 	opt     *Option
+	connOpt *Option // opt without RetryPolicy, xc retries on other servers itself, and with the default codec
 	mu      sync.Mutex
-	clients map[string]*Client
+	clients map[string]conn
+	closed  bool         // set by Close, no more connections are dialed
+	pool    *PoolOptions // dial a Pool instead of a Client per server if set
+	hedge   *HedgePolicy // hedge calls on other servers if set
+	logger  *slog.Logger
+	types   TypeChecker
+
+	balanceMu sync.Mutex
+	balancer  *balanced    // picks the servers of the calls, nil if the select mode isn't supported
+	keyed     *balanced    // picks the servers of CallWithKey if set, for the select modes ignoring keys
+	listed    []ServerInfo // servers of the discovery at the last pick
+
+	healthMu   sync.RWMutex
+	unhealthy  map[string]bool // servers not serving at the last health check
+	healthDone chan struct{}   // closed by Close to stop health checking
+
+	breakerMu   sync.Mutex
+	breakerOpts *BreakerOptions     // circuit breakers are enabled if set
+	breakers    map[string]*breaker // by server
+}
+
+// conn is the connection to one server, a *Client or a *Pool
+type conn interface {
+	Caller
+	io.Closer
+	IsAvailable() bool
+	NumPending() int
 }
 
 var _ io.Closer = (*XClient)(nil)
+var _ TypedCaller = (*XClient)(nil)
 
+// NewXClient creates a XClient, opt.Logger is used by the XClient, its clients and d if it has a SetLogger method.
+// The servers of d are picked by the built-in Balancer of mode, or the one set by SetBalancer. The Get method of a
+// SelectingDiscovery isn't used, wrap its selection in a Balancer to keep it.
 func NewXClient(d Discovery, mode SelectMode, opt *Option) *XClient {
-	return &XClient{
+	logger := DiscardLogger
+	if opt != nil && opt.Logger != nil {
+		logger = opt.Logger
+		if l, ok := d.(interface{ SetLogger(*slog.Logger) }); ok {
+			l.SetLogger(logger)
+		}
+	}
+	connOpt := opt
+	if opt != nil {
+		o := *opt
+		o.RetryPolicy = nil
+		if o.CodecType == "" { // set here, the concurrent dials mustn't fill in the default themselves
+			o.CodecType = DefaultOption.CodecType
+		}
+		connOpt = &o
+	}
+	xc := &XClient{
 		d:       d,
 		mode:    mode,
 		opt:     opt,
-		clients: make(map[string]*Client),
+		connOpt: connOpt,
+		clients: make(map[string]conn),
+		logger:  logger,
+	}
+	if b, err := NewBalancer(mode.String()); err == nil {
+		xc.balancer = &balanced{Balancer: b}
 	}
+	if mode != ConsistentHashSelect {
+		xc.keyed = &balanced{Balancer: newConsistentHashBalancer()}
+	}
+	return xc
+}
+
+// TypeChecker returns the cache of the type checks of geerpc.CallT
+func (xc *XClient) TypeChecker() *TypeChecker {
+	return &xc.types
 }
 
 func (xc *XClient) Close() error {
+	xc.stopHealthCheck()
 	xc.mu.Lock()
 	defer xc.mu.Unlock()
+	xc.closed = true
 	for key, client := range xc.clients {
 		_ = client.Close()
 		delete(xc.clients, key)
@@ -37,40 +102,128 @@ func (xc *XClient) Close() error {
 	return nil
 }
 
-func (xc *XClient) dial(rpcAddr string) (*Client, error) {
+// UsePool makes xc hold a Pool of connections to each server dialed from now on, instead of a single Client
+func (xc *XClient) UsePool(popts PoolOptions) {
 	xc.mu.Lock()
 	defer xc.mu.Unlock()
+	xc.pool = &popts
+}
+
+// EnableHedging makes xc hedge the calls of the methods of p, the copies of a call go to servers it wasn't sent to
+func (xc *XClient) EnableHedging(p *HedgePolicy) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	xc.hedge = p
+}
+
+// dial returns the connection to rpcAddr, dialing it without holding xc.mu so that a slow server doesn't hold up
+// the calls to the others. Of two concurrent dials to the same server, the second one is closed.
+func (xc *XClient) dial(rpcAddr string) (conn, error) {
+	xc.mu.Lock()
 	client, ok := xc.clients[rpcAddr]
 	if ok && !client.IsAvailable() {
 		_ = client.Close()
 		delete(xc.clients, rpcAddr)
-		client = nil
+		ok = false
 	}
-	if client == nil {
-		var err error
-		client, err = XDial(rpcAddr, xc.opt)
-		if err != nil {
-			return nil, err
-		}
-		xc.clients[rpcAddr] = client
+	pool, closed := xc.pool, xc.closed
+	xc.mu.Unlock()
+	if ok {
+		return client, nil
+	}
+	if closed {
+		return nil, ErrShutdown
+	}
+	var err error
+	if pool != nil {
+		client, err = NewPool(rpcAddr, *pool, xc.connOpt)
+	} else {
+		client, err = XDial(rpcAddr, xc.connOpt)
+	}
+	if err != nil {
+		xc.logger.Warn("rpc xclient: dial error", "addr", rpcAddr, "err", err)
+		return nil, NotSent(err)
 	}
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if xc.closed {
+		_ = client.Close()
+		return nil, ErrShutdown
+	}
+	if other, ok := xc.clients[rpcAddr]; ok && other.IsAvailable() {
+		_ = client.Close()
+		return other, nil
+	}
+	xc.clients[rpcAddr] = client
 	return client, nil
 }
 
 func (xc *XClient) call(rpcAddr string, ctx *context.Context, serviceMethod string, args, reply interface{}) error {
+	gen, ok := xc.acquireBreaker(rpcAddr)
+	if !ok {
+		return NotSent(Errorf(CodeUnavailable, "rpc xclient: circuit breaker of %s is open", rpcAddr))
+	}
 	client, err := xc.dial(rpcAddr)
-	if err != nil {
-		return err
+	if err == nil {
+		err = client.Call(*ctx, serviceMethod, args, reply)
 	}
-	return client.Call(*ctx, serviceMethod, args, reply)
+	xc.releaseBreaker(rpcAddr, gen, *ctx, err)
+	return err
 }
 
+// Call calls a server picked by the balancer, of the select mode unless SetBalancer was called. If Option.RetryPolicy is set, failed calls are retried
+// on servers not tried yet, as long as the discovery gives one, and so are the copies sent by EnableHedging.
 func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	rpcAddr, err := xc.d.Get(xc.mode)
-	if err != nil {
-		return err
+	return xc.invoke(ctx, nil, serviceMethod, args, reply)
+}
+
+// CallWithKey is like Call, but sends the call to the server of key on a consistent hash ring of the servers,
+// whatever the select mode. Calls with the same key then go to the same server while the server list doesn't
+// change. If that server isn't serving, the keys it has move to the others. Retries and hedged copies go to
+// other servers. A balancer set by SetBalancer is given the key instead.
+func (xc *XClient) CallWithKey(ctx context.Context, key, serviceMethod string, args, reply interface{}) error {
+	return xc.invoke(ctx, &key, serviceMethod, args, reply)
+}
+
+// invoke makes the call with key if set, its retries and hedged copies on servers not tried yet
+func (xc *XClient) invoke(ctx context.Context, key *string, serviceMethod string, args, reply interface{}) error {
+	var policy *RetryPolicy
+	if xc.opt != nil {
+		policy = xc.opt.RetryPolicy
+	}
+	xc.mu.Lock()
+	hedge := xc.hedge
+	xc.mu.Unlock()
+	info := PickInfo{
+		ServiceMethod: serviceMethod,
+		Metadata:      OutgoingMetadata(ctx),
+		Pending:       xc.pending,
+	}
+	if key != nil {
+		info.Key, info.HasKey = *key, true
 	}
-	return xc.call(rpcAddr, &ctx, serviceMethod, args, reply)
+	var mu sync.Mutex // protect tried from the hedged copies
+	tried := make(map[string]bool)
+	return policy.Do(ctx, serviceMethod, func() error {
+		return hedge.Do(ctx, serviceMethod, reply, func(ctx context.Context, reply interface{}) error {
+			mu.Lock()
+			rpcAddr, done, err := xc.pick(info, tried)
+			if err == nil {
+				tried[rpcAddr] = true
+			}
+			mu.Unlock()
+			if err != nil {
+				return err
+			}
+			start := time.Now()
+			err = xc.call(rpcAddr, &ctx, serviceMethod, args, reply)
+			if done != nil {
+				failed, counted := callOutcome(ctx, err)
+				done(DoneInfo{Err: err, Latency: time.Since(start), Failed: failed, Canceled: !counted})
+			}
+			return err
+		})
+	})
 }
 
 func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, reply interface{}) error {
@@ -78,11 +231,18 @@ func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, re
 	if err != nil {
 		return err
 	}
+	if healthy := xc.healthy(servers); len(healthy) < len(servers) {
+		if len(healthy) == 0 {
+			return Errorf(CodeUnavailable, "rpc xclient: no serving servers among %d", len(servers))
+		}
+		servers = healthy
+	}
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	var e error
 	replyDone := reply == nil
 	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	for _, rpcAddr := range servers {
 		wg.Add(1)
 		go func(rpcAddr string) {
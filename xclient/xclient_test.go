@@ -0,0 +1,328 @@
+package xclient
+
+import (
+	"context"
+	. "geerpc"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type Bench int
+
+func (b Bench) Echo(payload []byte, reply *[]byte) error {
+	*reply = payload
+	return nil
+}
+
+// startServers serves each of rcvrs on a server of its own until the test ends, it returns their addresses
+func startServers(tb testing.TB, rcvrs ...interface{}) []string {
+	var servers []string
+	for _, rcvr := range rcvrs {
+		s := NewServer()
+		if err := s.Register(rcvr); err != nil {
+			tb.Fatal("register error:", err)
+		}
+		l, err := net.Listen("tcp", ":0")
+		if err != nil {
+			tb.Fatal("network error:", err)
+		}
+		go s.Accept(l)
+		tb.Cleanup(func() { _ = l.Close() })
+		servers = append(servers, "tcp@"+l.Addr().String())
+	}
+	return servers
+}
+
+func BenchmarkXClient_Call(b *testing.B) {
+	servers := startServers(b, new(Bench), new(Bench))
+	for _, mode := range []struct {
+		name string
+		mode SelectMode
+	}{{"Random", RandomSelect}, {"RoundRobin", RoundRobinSelect}} {
+		b.Run(mode.name, func(b *testing.B) {
+			xc := NewXClient(NewMultiServerDiscovery(servers), mode.mode, nil)
+			defer func() { _ = xc.Close() }()
+			payload := make([]byte, 64)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					var reply []byte
+					if err := xc.Call(context.Background(), "Bench.Echo", payload, &reply); err != nil {
+						b.Error("call error:", err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+type Args struct{ Num1, Num2 int }
+
+type Foo int
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func TestCallT(t *testing.T) {
+	xc := NewXClient(NewMultiServerDiscovery(startServers(t, new(Foo))), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	if sum, err := CallT[Args, int](context.Background(), xc, "Foo.Sum", Args{Num1: 1, Num2: 2}); err != nil || sum != 3 {
+		t.Fatal("expect 3, got", sum, err)
+	}
+	if _, err := CallT[Args, []int](context.Background(), xc, "Foo.Sum", Args{}); CodeOf(err) != CodeInvalidArgument {
+		t.Fatal("expect mismatched types to be rejected, got", err)
+	}
+}
+
+func TestXClient_UsePool(t *testing.T) {
+	servers := startServers(t, new(Foo))
+	xc := NewXClient(NewMultiServerDiscovery(servers), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.UsePool(PoolOptions{MinConns: 2})
+	var reply int
+	if err := xc.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatal("expect 3, got", reply, err)
+	}
+	if p, ok := xc.clients[servers[0]].(*Pool); !ok || p.Len() != 2 {
+		t.Fatal("expect a pool of 2 connections, got", xc.clients)
+	}
+}
+
+// Shaky fails with Unavailable if Down is set
+type Shaky struct {
+	Down  bool
+	calls int32
+}
+
+func (s *Shaky) Get(_ int, reply *bool) error {
+	atomic.AddInt32(&s.calls, 1)
+	if s.Down {
+		return Errorf(CodeUnavailable, "down")
+	}
+	*reply = true
+	return nil
+}
+
+func (s *Shaky) Put(_ int, reply *bool) error {
+	return s.Get(0, reply)
+}
+
+func TestXClient_CallRetry(t *testing.T) {
+	down, up := &Shaky{Down: true}, &Shaky{}
+	dead, _ := net.Listen("tcp", ":0")
+	_ = dead.Close()
+	servers := append([]string{"tcp@" + dead.Addr().String()}, startServers(t, down, up)...)
+	opt := &Option{
+		MagicNumber:    MagicNumber,
+		ConnectTimeout: time.Second,
+		RetryPolicy: &RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     Backoff{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Multiplier: 1},
+			Idempotent:  map[string]bool{"Shaky.Get": true},
+		},
+	}
+	xc := NewXClient(NewMultiServerDiscovery(servers), RoundRobinSelect, opt)
+	defer func() { _ = xc.Close() }()
+
+	for i := 0; i < 6; i++ {
+		var ok bool
+		if err := xc.Call(context.Background(), "Shaky.Get", 0, &ok); err != nil || !ok {
+			t.Fatal("expect idempotent calls to be retried on other servers, got", err)
+		}
+	}
+	if atomic.LoadInt32(&down.calls) == 0 || atomic.LoadInt32(&up.calls) != 6 {
+		t.Fatal("expect every call to end on the serving server, got", down.calls, up.calls)
+	}
+
+	failed, downCalls := 0, atomic.LoadInt32(&down.calls)
+	for i := 0; i < 6; i++ {
+		var ok bool
+		err := xc.Call(context.Background(), "Shaky.Put", 0, &ok)
+		if err != nil && IsNotSent(err) {
+			t.Fatal("expect dial failures to be retried, got", err)
+		}
+		if err != nil {
+			failed++
+		}
+	}
+	// the calls reaching the dead server are retried, those reaching down aren't
+	if failed == 0 || int32(failed) != atomic.LoadInt32(&down.calls)-downCalls {
+		t.Fatal("expect only dial failures to be retried for non idempotent calls, got", failed, "failures")
+	}
+}
+
+// Sleepy sleeps Delay before replying its name
+type Sleepy struct {
+	Name  string
+	Delay time.Duration
+}
+
+func (s *Sleepy) Hello(_ int, reply *string) error {
+	time.Sleep(s.Delay)
+	*reply = s.Name
+	return nil
+}
+
+func TestXClient_EnableHedging(t *testing.T) {
+	servers := startServers(t, &Sleepy{Name: "slow", Delay: time.Second}, &Sleepy{Name: "fast"})
+	xc := NewXClient(NewMultiServerDiscovery(servers), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.EnableHedging(&HedgePolicy{Delay: time.Millisecond * 20, Budget: 1, Methods: map[string]bool{"Sleepy": true}})
+
+	for i := 0; i < 4; i++ {
+		start := time.Now()
+		var name string
+		if err := xc.Call(context.Background(), "Sleepy.Hello", 0, &name); err != nil || name != "fast" {
+			t.Fatal("expect the fast server to answer first, got", name, err)
+		}
+		if d := time.Since(start); d > time.Millisecond*500 {
+			t.Fatal("expect hedging to skip the slow server, took", d)
+		}
+	}
+}
+
+func TestXClient_CallWithKey(t *testing.T) {
+	servers := startServers(t, &Sleepy{Name: "a"}, &Sleepy{Name: "b"}, &Sleepy{Name: "c"})
+	d := NewMultiServerDiscovery(servers)
+	xc := NewXClient(d, ConsistentHashSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	hello := func(key string) string {
+		var name string
+		if err := xc.CallWithKey(context.Background(), key, "Sleepy.Hello", 0, &name); err != nil {
+			t.Fatal("call error:", err)
+		}
+		return name
+	}
+	owners := make(map[string]string)
+	used := make(map[string]bool)
+	for i := 0; len(used) < 3 && i < 1000; i++ { // the ports, and so the ring, differ on every run
+		key := "user-" + strconv.Itoa(i)
+		owners[key] = hello(key)
+		used[owners[key]] = true
+		if again := hello(key); again != owners[key] {
+			t.Fatal("expect the same server for the same key, got", owners[key], again)
+		}
+	}
+	if len(used) != 3 {
+		t.Fatal("expect the keys to be spread over every server, got", used)
+	}
+
+	_ = d.Update(servers[1:]) // a leaves
+	for key, owner := range owners {
+		got := hello(key)
+		if got == "a" || (owner != "a" && got != owner) {
+			t.Fatal("expect only the keys of the removed server to move, key", key, "moved from", owner, "to", got)
+		}
+	}
+
+	var name string
+	if err := xc.Call(context.Background(), "Sleepy.Hello", 0, &name); err != nil || name == "a" {
+		t.Fatal("expect calls without a key to go to any server, got", name, err)
+	}
+	if _, err := d.Get(ConsistentHashSelect); err == nil {
+		t.Fatal("expect Get without a key to fail in consistent hash mode")
+	}
+}
+
+// Napper sleeps the given milliseconds plus Delay before replying its name
+type Napper struct {
+	Name  string
+	Delay time.Duration
+	calls int32
+}
+
+func (n *Napper) Nap(ms int, reply *string) error {
+	atomic.AddInt32(&n.calls, 1)
+	time.Sleep(time.Duration(ms)*time.Millisecond + n.Delay)
+	*reply = n.Name
+	return nil
+}
+
+func TestXClient_LeastPendingSelect(t *testing.T) {
+	a, b := &Napper{Name: "a"}, &Napper{Name: "b"}
+	servers := startServers(t, a, b)
+	xc := NewXClient(NewMultiServerDiscovery(servers), LeastPendingSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	var busy string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = xc.Call(context.Background(), "Napper.Nap", 300, &busy)
+	}()
+	for xc.pending(servers[0])+xc.pending(servers[1]) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	idle := "b"
+	if xc.pending(servers[1]) > 0 {
+		idle = "a"
+	}
+	for i := 0; i < 5; i++ {
+		var name string
+		if err := xc.Call(context.Background(), "Napper.Nap", 0, &name); err != nil || name != idle {
+			t.Fatal("expect the server without pending calls, got", name, err)
+		}
+	}
+	<-done
+}
+
+func TestXClient_P2CSelect(t *testing.T) {
+	slow, fast := &Napper{Name: "slow", Delay: time.Millisecond * 20}, &Napper{Name: "fast"}
+	xc := NewXClient(NewMultiServerDiscovery(startServers(t, slow, fast)), P2CSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	for i := 0; i < 30; i++ {
+		var name string
+		if err := xc.Call(context.Background(), "Napper.Nap", 0, &name); err != nil {
+			t.Fatal("call error:", err)
+		}
+	}
+	if n := atomic.LoadInt32(&slow.calls); n > 2 {
+		t.Fatal("expect the slow server to be avoided once measured, it got", n, "calls")
+	}
+}
+
+func TestServerLoad(t *testing.T) {
+	now := time.Now()
+	l := &serverLoad{}
+	l.observe(time.Millisecond*10, now)
+	l.observe(time.Millisecond*100, now)
+	if l.cost != float64(time.Millisecond*100) {
+		t.Fatal("expect the cost to jump to a peak, got", time.Duration(l.cost))
+	}
+	l.observe(time.Millisecond*10, now.Add(ewmaDecay))
+	if cost := time.Duration(l.cost); cost < time.Millisecond*30 || cost > time.Millisecond*50 {
+		t.Fatal("expect the cost to decay by 1/e after ewmaDecay, got", cost)
+	}
+	if (*serverLoad)(nil).score(0) != 0 || l.score(1) != 2*l.cost {
+		t.Fatal("expect the score to grow with the pending calls")
+	}
+}
+
+func TestXClient_DialDoesNotBlockOthers(t *testing.T) {
+	l, _ := net.Listen("tcp", ":0") // accepts but never answers the HTTP CONNECT
+	t.Cleanup(func() { _ = l.Close() })
+	hanging := "http@" + l.Addr().String()
+	servers := startServers(t, &Napper{Name: "a"})
+	xc := NewXClient(NewMultiServerDiscovery(servers), RandomSelect, &Option{MagicNumber: MagicNumber, ConnectTimeout: time.Second})
+	defer func() { _ = xc.Close() }()
+
+	go func() { _, _ = xc.dial(hanging) }()
+	time.Sleep(time.Millisecond * 50)
+	start := time.Now()
+	var name string
+	if err := xc.Call(context.Background(), "Napper.Nap", 0, &name); err != nil || name != "a" {
+		t.Fatal("call error:", err)
+	}
+	if d := time.Since(start); d > time.Millisecond*500 {
+		t.Fatal("expect the dial of a hanging server not to hold up the calls, took", d)
+	}
+}